@@ -0,0 +1,322 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Roles recognised by the access control guard
+const (
+	RoleFarmer       = "farmer"
+	RoleLab          = "lab"
+	RoleProcessor    = "processor"
+	RoleManufacturer = "manufacturer"
+	RoleAdmin        = "admin"
+	RoleRegulator    = "regulator"
+	RoleSupervisor   = "supervisor" // Cooperative field supervisor, carried as a role attribute
+
+	// roleAny allows any caller that resolves to a known role (read-only queries)
+	roleAny = "*"
+
+	// roleAttribute is the certificate attribute (Fabric CA attrs) carrying the caller role
+	roleAttribute = "role"
+
+	// participantAttribute is the certificate attribute binding a member to the registered participant
+	// they act for, e.g. a lab technician to their lab; without it the enrollment ID is the participant ID
+	participantAttribute = "participantId"
+)
+
+// mspRoles maps each organization MSP to the participant role its members hold by default
+var mspRoles = map[string]string{
+	"FarmersCoopMSP":   RoleFarmer,
+	"TestingLabsMSP":   RoleLab,
+	"ProcessorsMSP":    RoleProcessor,
+	"ManufacturersMSP": RoleManufacturer,
+}
+
+// privilegedRoleMSPs lists the organizations whose certificates may carry the admin and regulator
+// role attributes; the same attributes from any other MSP are refused. Every member org keeps admins
+// so that governance proposals can gather approvals from distinct organizations. Regulators are only
+// enrolled by the cooperative and the testing labs.
+var privilegedRoleMSPs = map[string][]string{
+	RoleAdmin:     {"FarmersCoopMSP", "TestingLabsMSP", "ProcessorsMSP", "ManufacturersMSP"},
+	RoleRegulator: {"FarmersCoopMSP", "TestingLabsMSP"},
+}
+
+// accessPolicy lists the roles allowed to invoke each exported transaction.
+// Transactions without an entry are denied; governed operations (see governedOperations)
+// have no entry because they are only applied through ExecuteProposal.
+var accessPolicy = map[string][]string{
+	// Ledger setup
+	"InitLedger": {RoleAdmin},
+
+	// Collection events
+	"CreateCollectionEvent":     {RoleFarmer, RoleAdmin},
+	"ValidateCollectionEvent":   {RoleFarmer, RoleAdmin},
+	"GetCollectionEvent":        {roleAny},
+	"QueryCollectionsByFarmer":  {roleAny},
+	"QueryCollectionsBySpecies": {roleAny},
+	"VerifyCollectionEvent":     {RoleSupervisor, RoleAdmin, RoleRegulator},
+	"RejectCollectionEvent":     {RoleSupervisor, RoleAdmin, RoleRegulator},
+	"GetCollectionEventReviews": {roleAny},
+
+	// Collection event private data (details are readable only from FarmersCoopMSP, the collection member)
+	"GetCollectionEventPrivateDetails": {RoleFarmer, RoleAdmin, RoleRegulator},
+	"VerifyCollectionEventPrivateData": {roleAny},
+
+	// Quality tests, processing and products
+	"CreateQualityTest":     {RoleLab},
+	"GetQualityTest":        {roleAny},
+	"CreateProcessingStep":  {RoleProcessor},
+	"GetProcessingStep":     {roleAny},
+	"CreateProduct":         {RoleManufacturer},
+	"GetProduct":            {roleAny},
+	"GetProductByQRCode":    {roleAny},
+	"GenerateProvenance":    {roleAny},
+	"GetProvenanceByQRCode": {roleAny},
+
+	// Batches
+	"CreateBatch":             {RoleFarmer, RoleAdmin},
+	"GetBatch":                {roleAny},
+	"AssignBatchToProcessor":  {RoleAdmin},
+	"UpdateBatchStatus":       {RoleAdmin, RoleLab, RoleProcessor, RoleManufacturer},
+	"GetBatchHistory":         {roleAny},
+	"QueryBatchesByStatus":    {roleAny},
+	"QueryBatchesByProcessor": {roleAny},
+	"GetPendingBatches":       {roleAny},
+
+	// Alerts
+	"CreateAlert":         {RoleAdmin, RoleRegulator},
+	"GetAlert":            {roleAny},
+	"GetAlerts":           {roleAny},
+	"GetAlertsByType":     {roleAny},
+	"GetAlertsBySeverity": {roleAny},
+	"GetActiveAlerts":     {roleAny},
+	"GetAlertsByEntity":   {roleAny},
+	"AcknowledgeAlert":    {RoleAdmin, RoleRegulator},
+	"ResolveAlert":        {RoleAdmin, RoleRegulator},
+	"GetCriticalAlerts":   {roleAny},
+	"GetAlertStatistics":  {roleAny},
+
+	// Participants
+	"RegisterParticipant":     {RoleAdmin},
+	"UpdateParticipant":       {RoleAdmin},
+	"SuspendParticipant":      {RoleAdmin, RoleRegulator},
+	"ReactivateParticipant":   {RoleAdmin},
+	"GetParticipant":          {roleAny},
+	"QueryParticipantsByRole": {roleAny},
+
+	// Lab accreditations
+	"RegisterLabAccreditation": {RoleAdmin, RoleRegulator},
+	"RevokeLabAccreditation":   {RoleAdmin, RoleRegulator},
+	"GetLabAccreditation":      {roleAny},
+	"GetLabAccreditations":     {roleAny},
+
+	// Signing keys
+	"RegisterSigningKey":               {RoleAdmin, RoleLab, RoleFarmer},
+	"RevokeSigningKey":                 {RoleAdmin, RoleRegulator, RoleLab, RoleFarmer},
+	"GetSigningKey":                    {roleAny},
+	"GetQualityTestSigningPayload":     {roleAny},
+	"GetCollectionEventSigningPayload": {roleAny},
+
+	// Endorsement policies
+	"GetEndorsementOrgs": {roleAny},
+
+	// Species registry
+	"RegisterSpecies": {RoleAdmin},
+	"UpdateSpecies":   {RoleAdmin},
+	"GetSpecies":      {roleAny},
+	"ResolveSpecies":  {roleAny},
+	"GetAllSpecies":   {roleAny},
+
+	// Conservation status
+	"GetConservationStatus":            {roleAny},
+	"QueryConservationStatusBySpecies": {roleAny},
+
+	// Harvest permits
+	"RegisterHarvestPermit":       {RoleAdmin, RoleRegulator},
+	"RevokeHarvestPermit":         {RoleAdmin, RoleRegulator},
+	"GetHarvestPermit":            {roleAny},
+	"QueryHarvestPermitsByHolder": {RoleFarmer, RoleAdmin, RoleRegulator},
+
+	// GPS plausibility
+	"SetGPSPolicy": {RoleAdmin},
+	"GetGPSPolicy": {roleAny},
+
+	// Fraud detection
+	"SetFraudPolicy":         {RoleAdmin},
+	"GetFraudPolicy":         {roleAny},
+	"GetFarmerDailyActivity": {RoleFarmer, RoleAdmin, RoleRegulator},
+
+	// Approved zones
+	"GetApprovedZone":             {roleAny},
+	"GetApprovedZoneVersion":      {roleAny},
+	"GetApprovedZoneVersions":     {roleAny},
+	"QueryApprovedZonesBySpecies": {roleAny},
+
+	// Personal data erasure and retention
+	"GetRetentionPolicy":   {RoleAdmin, RoleRegulator},
+	"ApplyRetentionPolicy": {RoleAdmin},
+	"RequestDataErasure":   {RoleFarmer, RoleAdmin},
+	"ExecuteDataErasure":   {RoleAdmin},
+	"RejectDataErasure":    {RoleAdmin},
+	"GetErasureRequest":    {RoleFarmer, RoleAdmin, RoleRegulator},
+	"QueryErasureLogs":     {RoleFarmer, RoleAdmin, RoleRegulator},
+
+	// Batch commercial terms
+	"SetBatchCommercialTerms":    {RoleFarmer, RoleProcessor, RoleAdmin},
+	"GetBatchCommercialTerms":    {RoleFarmer, RoleProcessor, RoleAdmin},
+	"VerifyBatchCommercialTerms": {roleAny},
+
+	// Governance
+	"CreateProposal":         {RoleAdmin, RoleRegulator},
+	"ApproveProposal":        {RoleAdmin, RoleRegulator},
+	"RejectProposal":         {RoleAdmin, RoleRegulator},
+	"ExecuteProposal":        {RoleAdmin, RoleRegulator},
+	"GetProposal":            {roleAny},
+	"QueryProposalsByStatus": {roleAny},
+	"GetProposalHistory":     {roleAny},
+	"GetGovernanceConfig":    {roleAny},
+
+	// Season windows and harvest limits
+	"ValidateSeasonWindow":  {roleAny},
+	"DeclareSeasonClosure":  {RoleAdmin, RoleRegulator},
+	"GetSeasonCalendar":     {roleAny},
+	"ResolveSeason":         {roleAny},
+	"GetSeasonWindows":      {roleAny},
+	"TrackHarvestQuantity":  {RoleAdmin},
+	"ValidateHarvestLimit":  {roleAny},
+	"GetHarvestStatistics":  {roleAny},
+	"GetFarmerAllowance":    {RoleFarmer, RoleAdmin, RoleRegulator},
+	"GetHarvestLimitAlerts": {roleAny},
+}
+
+// ClientIdentity describes the submitter of the current transaction
+type ClientIdentity struct {
+	MSPID         string `json:"mspId"`
+	EnrollmentID  string `json:"enrollmentId"` // Certificate common name issued by the org CA
+	Role          string `json:"role"`
+	ParticipantID string `json:"participantId"` // Registered participant the submitter acts for
+}
+
+// getClientIdentity resolves the MSP ID, enrollment ID and role of the transaction submitter.
+// The role comes from the "role" certificate attribute when present, otherwise
+// from the submitter's organization. Participant roles carried in an attribute
+// must match the organization; admin and regulator must belong to an org in privilegedRoleMSPs.
+// The participant comes from the "participantId" attribute when present, otherwise it is the
+// enrollment ID.
+func getClientIdentity(ctx contractapi.TransactionContextInterface) (*ClientIdentity, error) {
+	clientID := ctx.GetClientIdentity()
+	if clientID == nil {
+		return nil, fmt.Errorf("access denied: client identity unavailable")
+	}
+
+	mspID, err := clientID.GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("access denied: failed to read client MSP ID: %v", err)
+	}
+
+	cert, err := clientID.GetX509Certificate()
+	if err != nil {
+		return nil, fmt.Errorf("access denied: failed to read client certificate: %v", err)
+	}
+	if cert == nil || cert.Subject.CommonName == "" {
+		return nil, fmt.Errorf("access denied: client certificate has no enrollment ID")
+	}
+
+	orgRole := mspRoles[mspID]
+	role := orgRole
+
+	attrRole, found, err := clientID.GetAttributeValue(roleAttribute)
+	if err != nil {
+		return nil, fmt.Errorf("access denied: failed to read role attribute: %v", err)
+	}
+	if found && attrRole != "" {
+		attrRole = strings.ToLower(attrRole)
+		switch attrRole {
+		case RoleAdmin, RoleRegulator:
+			if !containsString(privilegedRoleMSPs[attrRole], mspID) {
+				return nil, fmt.Errorf("access denied: role %s is not permitted for members of %s", attrRole, mspID)
+			}
+			role = attrRole
+		case RoleSupervisor:
+			if orgRole != RoleFarmer {
+				return nil, fmt.Errorf("access denied: supervisors must be members of a farmer cooperative, not %s", mspID)
+			}
+			role = attrRole
+		case RoleFarmer, RoleLab, RoleProcessor, RoleManufacturer:
+			if attrRole != orgRole {
+				return nil, fmt.Errorf("access denied: role %s is not permitted for members of %s", attrRole, mspID)
+			}
+		default:
+			return nil, fmt.Errorf("access denied: unknown role attribute: %s", attrRole)
+		}
+	}
+
+	if role == "" {
+		return nil, fmt.Errorf("access denied: no role assigned to members of %s", mspID)
+	}
+
+	participantID, found, err := clientID.GetAttributeValue(participantAttribute)
+	if err != nil {
+		return nil, fmt.Errorf("access denied: failed to read participant attribute: %v", err)
+	}
+	if !found || participantID == "" {
+		participantID = cert.Subject.CommonName
+	}
+
+	return &ClientIdentity{MSPID: mspID, EnrollmentID: cert.Subject.CommonName, Role: role, ParticipantID: participantID}, nil
+}
+
+// resolveActor returns the submitter identity and the actor ID to record for it.
+// An empty claimed ID is filled with the submitter's enrollment ID; a claimed ID
+// that differs from it is rejected unless onBehalf is set and the submitter is
+// an admin recording the action for another participant.
+func resolveActor(ctx contractapi.TransactionContextInterface, claimed string, onBehalf bool) (*ClientIdentity, string, error) {
+	identity, err := getClientIdentity(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if claimed == "" || claimed == identity.EnrollmentID {
+		return identity, identity.EnrollmentID, nil
+	}
+	if onBehalf && identity.Role == RoleAdmin {
+		return identity, claimed, nil
+	}
+
+	return nil, "", fmt.Errorf("access denied: actor ID %s does not match submitter %s (%s)",
+		claimed, identity.EnrollmentID, identity.MSPID)
+}
+
+// checkAccess is the shared guard run before every transaction of the contract
+func (c *HerbalTraceContract) checkAccess(ctx contractapi.TransactionContextInterface) error {
+	function, _ := ctx.GetStub().GetFunctionAndParameters()
+	if i := strings.LastIndex(function, ":"); i >= 0 {
+		function = function[i+1:]
+	}
+
+	allowed, exists := accessPolicy[function]
+	if !exists {
+		if _, governed := governedOperations[function]; governed {
+			return fmt.Errorf("access denied: %s is a governed operation; submit it with CreateProposal and apply it with ExecuteProposal", function)
+		}
+		return fmt.Errorf("access denied: no access policy defined for transaction %s", function)
+	}
+
+	identity, err := getClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, role := range allowed {
+		if role == roleAny || role == identity.Role {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("access denied: role %s (%s) is not authorized to invoke %s; allowed roles: %s",
+		identity.Role, identity.MSPID, function, strings.Join(allowed, ", "))
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// LabAccreditation represents an accreditation certificate held by a testing lab
+type LabAccreditation struct {
+	ID                string   `json:"id"`
+	Type              string   `json:"type"` // "LabAccreditation"
+	LabID             string   `json:"labId"`
+	AccreditingBody   string   `json:"accreditingBody"` // "NABL", "ISO/IEC 17025", etc.
+	CertificateNumber string   `json:"certificateNumber"`
+	ValidFrom         string   `json:"validFrom"`          // RFC3339 or YYYY-MM-DD
+	ValidUntil        string   `json:"validUntil"`         // RFC3339 or YYYY-MM-DD
+	TestTypes         []string `json:"testTypes"`          // Test types in scope, e.g. "pesticide", "heavy_metals"
+	Matrices          []string `json:"matrices,omitempty"` // Sample matrices in scope, e.g. "raw_herb", "powder", "extract"
+	Status            string   `json:"status"`             // "active", "revoked"
+	RevocationReason  string   `json:"revocationReason,omitempty"`
+	CreatedBy         string   `json:"createdBy"`
+	CreatedAt         string   `json:"createdAt"`
+	UpdatedAt         string   `json:"updatedAt"`
+}
+
+// accreditationKey returns the ledger key for an accreditation ID
+func accreditationKey(accreditationID string) string {
+	return "accreditation_" + accreditationID
+}
+
+// RegisterLabAccreditation records an accreditation certificate for a registered lab
+func (c *HerbalTraceContract) RegisterLabAccreditation(ctx contractapi.TransactionContextInterface, accreditationJSON string) error {
+	var accreditation LabAccreditation
+	err := json.Unmarshal([]byte(accreditationJSON), &accreditation)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal accreditation JSON: %v", err)
+	}
+
+	// Validate required fields
+	if accreditation.ID == "" {
+		return fmt.Errorf("accreditation ID is required")
+	}
+	if accreditation.AccreditingBody == "" {
+		return fmt.Errorf("accrediting body is required")
+	}
+	if accreditation.CertificateNumber == "" {
+		return fmt.Errorf("certificate number is required")
+	}
+	if len(accreditation.TestTypes) == 0 {
+		return fmt.Errorf("at least one test type is required")
+	}
+	validFrom, err := parseLedgerDate(accreditation.ValidFrom)
+	if err != nil {
+		return fmt.Errorf("invalid valid-from date: %v", err)
+	}
+	validUntil, err := parseLedgerDate(accreditation.ValidUntil)
+	if err != nil {
+		return fmt.Errorf("invalid valid-until date: %v", err)
+	}
+	if !validUntil.After(validFrom) {
+		return fmt.Errorf("valid-until date must be after valid-from date")
+	}
+
+	participant, err := c.GetParticipant(ctx, accreditation.LabID)
+	if err != nil {
+		return err
+	}
+	if participant.Role != RoleLab {
+		return fmt.Errorf("participant %s is not a lab", accreditation.LabID)
+	}
+
+	// Check if accreditation already exists
+	existingAccreditation, err := ctx.GetStub().GetState(accreditationKey(accreditation.ID))
+	if err != nil {
+		return fmt.Errorf("failed to check if accreditation exists: %v", err)
+	}
+	if existingAccreditation != nil {
+		return fmt.Errorf("accreditation with ID %s already exists", accreditation.ID)
+	}
+
+	identity, err := getClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Set default values
+	accreditation.Type = "LabAccreditation"
+	accreditation.Status = "active"
+	accreditation.RevocationReason = ""
+	accreditation.CreatedBy = identity.EnrollmentID
+	accreditation.CreatedAt = txTime.Format(time.RFC3339)
+	accreditation.UpdatedAt = txTime.Format(time.RFC3339)
+
+	if err := c.putLabAccreditation(ctx, &accreditation); err != nil {
+		return err
+	}
+
+	// Emit event
+	eventPayload := map[string]interface{}{
+		"eventType":         "LabAccreditationRegistered",
+		"accreditationId":   accreditation.ID,
+		"labId":             accreditation.LabID,
+		"accreditingBody":   accreditation.AccreditingBody,
+		"certificateNumber": accreditation.CertificateNumber,
+		"validUntil":        accreditation.ValidUntil,
+		"timestamp":         accreditation.CreatedAt,
+	}
+	eventBytes, _ := json.Marshal(eventPayload)
+	ctx.GetStub().SetEvent("LabAccreditationRegistered", eventBytes)
+
+	return nil
+}
+
+// RevokeLabAccreditation withdraws an accreditation before its expiry date
+func (c *HerbalTraceContract) RevokeLabAccreditation(ctx contractapi.TransactionContextInterface, accreditationID string, reason string) error {
+	if reason == "" {
+		return fmt.Errorf("reason is required")
+	}
+
+	accreditation, err := c.GetLabAccreditation(ctx, accreditationID)
+	if err != nil {
+		return err
+	}
+	if accreditation.Status == "revoked" {
+		return fmt.Errorf("accreditation %s is already revoked", accreditationID)
+	}
+
+	accreditation.Status = "revoked"
+	accreditation.RevocationReason = reason
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+	accreditation.UpdatedAt = txTime.Format(time.RFC3339)
+
+	if err := c.putLabAccreditation(ctx, accreditation); err != nil {
+		return err
+	}
+
+	// Emit event
+	eventPayload := map[string]interface{}{
+		"eventType":       "LabAccreditationRevoked",
+		"accreditationId": accreditation.ID,
+		"labId":           accreditation.LabID,
+		"reason":          reason,
+		"timestamp":       accreditation.UpdatedAt,
+	}
+	eventBytes, _ := json.Marshal(eventPayload)
+	ctx.GetStub().SetEvent("LabAccreditationRevoked", eventBytes)
+
+	return nil
+}
+
+// GetLabAccreditation retrieves an accreditation by ID
+func (c *HerbalTraceContract) GetLabAccreditation(ctx contractapi.TransactionContextInterface, accreditationID string) (*LabAccreditation, error) {
+	if accreditationID == "" {
+		return nil, fmt.Errorf("accreditation ID is required")
+	}
+
+	accreditationBytes, err := ctx.GetStub().GetState(accreditationKey(accreditationID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read accreditation from ledger: %v", err)
+	}
+	if accreditationBytes == nil {
+		return nil, fmt.Errorf("accreditation with ID %s does not exist", accreditationID)
+	}
+
+	var accreditation LabAccreditation
+	err = json.Unmarshal(accreditationBytes, &accreditation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal accreditation: %v", err)
+	}
+
+	return &accreditation, nil
+}
+
+// GetLabAccreditations retrieves all accreditations held by a lab
+func (c *HerbalTraceContract) GetLabAccreditations(ctx contractapi.TransactionContextInterface, labID string) ([]*LabAccreditation, error) {
+	if labID == "" {
+		return nil, fmt.Errorf("lab ID is required")
+	}
+
+	queryString := fmt.Sprintf(`{
+		"selector": {
+			"type": "LabAccreditation",
+			"labId": "%s"
+		}
+	}`, labID)
+
+	resultsIterator, err := ctx.GetStub().GetQueryResult(queryString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query accreditations: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	var accreditations []*LabAccreditation
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate query results: %v", err)
+		}
+
+		var accreditation LabAccreditation
+		err = json.Unmarshal(queryResponse.Value, &accreditation)
+		if err != nil {
+			continue
+		}
+		accreditations = append(accreditations, &accreditation)
+	}
+
+	return accreditations, nil
+}
+
+// putLabAccreditation saves an accreditation to the ledger
+func (c *HerbalTraceContract) putLabAccreditation(ctx contractapi.TransactionContextInterface, accreditation *LabAccreditation) error {
+	accreditationBytes, err := json.Marshal(accreditation)
+	if err != nil {
+		return fmt.Errorf("failed to marshal accreditation: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(accreditationKey(accreditation.ID), accreditationBytes)
+	if err != nil {
+		return fmt.Errorf("failed to save accreditation to ledger: %v", err)
+	}
+
+	return nil
+}
+
+// checkLabAccreditation verifies that the lab holds an active accreditation, valid at the transaction
+// time and already valid on the test date, covering every test type and the sample matrix of the test.
+// A test date after the transaction time is refused. It returns the ID of a matching accreditation, or
+// the list of scope problems found.
+func (c *HerbalTraceContract) checkLabAccreditation(ctx contractapi.TransactionContextInterface, test QualityTest) (string, []string, error) {
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	testDate := txTime
+	if test.TestDate != "" {
+		parsed, err := parseLedgerDate(test.TestDate)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid test date: %v", err)
+		}
+		if parsed.After(txTime.Add(maxCaptureClockSkew)) {
+			return "", nil, fmt.Errorf("test date %s is after the transaction time %s", test.TestDate, txTime.Format(time.RFC3339))
+		}
+		testDate = parsed
+	}
+
+	accreditations, err := c.GetLabAccreditations(ctx, test.LabID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Collect the scope of every accreditation valid now that already covered the test date
+	covered := map[string]bool{}
+	var valid []*LabAccreditation
+	for _, accreditation := range accreditations {
+		if accreditation.Status != "active" {
+			continue
+		}
+		validFrom, err := parseLedgerDate(accreditation.ValidFrom)
+		if err != nil {
+			continue
+		}
+		validUntil, err := parseLedgerDate(accreditation.ValidUntil)
+		if err != nil {
+			continue
+		}
+		if testDate.Before(validFrom) || txTime.Before(validFrom) || txTime.After(validUntil) {
+			continue
+		}
+		if !accreditationCoversMatrix(accreditation, test.Matrix) {
+			continue
+		}
+
+		valid = append(valid, accreditation)
+		for _, testType := range accreditation.TestTypes {
+			covered[strings.ToLower(testType)] = true
+		}
+	}
+
+	if len(valid) == 0 {
+		if test.Matrix != "" {
+			return "", []string{fmt.Sprintf("lab %s holds no valid accreditation for matrix %s on %s", test.LabID, test.Matrix, testDate.Format("2006-01-02"))}, nil
+		}
+		return "", []string{fmt.Sprintf("lab %s holds no valid accreditation on %s", test.LabID, testDate.Format("2006-01-02"))}, nil
+	}
+
+	var issues []string
+	for _, testType := range test.TestTypes {
+		if !covered[strings.ToLower(testType)] {
+			issues = append(issues, fmt.Sprintf("test type %s is outside the accredited scope of lab %s", testType, test.LabID))
+		}
+	}
+	if len(issues) > 0 {
+		return "", issues, nil
+	}
+
+	return valid[0].ID, nil, nil
+}
+
+// accreditationCoversMatrix checks whether an accreditation covers a sample matrix.
+// Accreditations without listed matrices cover every matrix.
+func accreditationCoversMatrix(accreditation *LabAccreditation, matrix string) bool {
+	if len(accreditation.Matrices) == 0 {
+		return true
+	}
+	for _, m := range accreditation.Matrices {
+		if strings.EqualFold(m, matrix) {
+			return true
+		}
+	}
+	return false
+}
@@ -10,24 +10,26 @@ import (
 
 // Alert represents a system alert for violations, failures, or compliance issues
 type Alert struct {
-	ID               string `json:"id"`
-	Type             string `json:"type"` // "Alert"
-	AlertType        string `json:"alertType"` // "over_harvest", "quality_failure", "zone_violation", "season_violation", "compliance"
-	Severity         string `json:"severity"` // "low", "medium", "high", "critical"
-	EntityID         string `json:"entityId"` // Related batch/collection/test ID
-	EntityType       string `json:"entityType"` // "Batch", "CollectionEvent", "QualityTest", "ProcessingStep", "Product"
-	Species          string `json:"species,omitempty"`
-	Zone             string `json:"zone,omitempty"`
-	Message          string `json:"message"`
-	Details          string `json:"details"`
-	Timestamp        string `json:"timestamp"`
-	Status           string `json:"status"` // "active", "acknowledged", "resolved"
-	CreatedBy        string `json:"createdBy,omitempty"` // System or user ID
-	AcknowledgedBy   string `json:"acknowledgedBy,omitempty"`
-	AcknowledgedDate string `json:"acknowledgedDate,omitempty"`
-	ResolvedBy       string `json:"resolvedBy,omitempty"`
-	ResolvedDate     string `json:"resolvedDate,omitempty"`
-	Resolution       string `json:"resolution,omitempty"`
+	ID                string `json:"id"`
+	Type              string `json:"type"`       // "Alert"
+	AlertType         string `json:"alertType"`  // "over_harvest", "quality_failure", "zone_violation", "season_violation", "compliance", "gps_accuracy", "altitude_violation", "gps_spoofing", "suspicious_activity"
+	Severity          string `json:"severity"`   // "low", "medium", "high", "critical"
+	EntityID          string `json:"entityId"`   // Related batch/collection/test ID
+	EntityType        string `json:"entityType"` // "Batch", "CollectionEvent", "QualityTest", "ProcessingStep", "Product"
+	Species           string `json:"species,omitempty"`
+	Zone              string `json:"zone,omitempty"`
+	Message           string `json:"message"`
+	Details           string `json:"details"`
+	Timestamp         string `json:"timestamp"`
+	Status            string `json:"status"`              // "active", "acknowledged", "resolved"
+	CreatedBy         string `json:"createdBy,omitempty"` // System or user ID
+	AcknowledgedBy    string `json:"acknowledgedBy,omitempty"`
+	AcknowledgedByMSP string `json:"acknowledgedByMsp,omitempty"` // MSP ID of the acknowledging identity
+	AcknowledgedDate  string `json:"acknowledgedDate,omitempty"`
+	ResolvedBy        string `json:"resolvedBy,omitempty"`
+	ResolvedByMSP     string `json:"resolvedByMsp,omitempty"` // MSP ID of the resolving identity
+	ResolvedDate      string `json:"resolvedDate,omitempty"`
+	Resolution        string `json:"resolution,omitempty"`
 }
 
 // CreateAlert creates a new alert on the blockchain
@@ -54,12 +56,16 @@ func (c *HerbalTraceContract) CreateAlert(ctx contractapi.TransactionContextInte
 
 	// Validate alert type
 	validAlertTypes := map[string]bool{
-		"over_harvest":     true,
-		"quality_failure":  true,
-		"zone_violation":   true,
-		"season_violation": true,
-		"compliance":       true,
-		"system":           true,
+		"over_harvest":        true,
+		"quality_failure":     true,
+		"zone_violation":      true,
+		"season_violation":    true,
+		"compliance":          true,
+		"gps_accuracy":        true,
+		"altitude_violation":  true,
+		"gps_spoofing":        true,
+		"suspicious_activity": true,
+		"system":              true,
 	}
 	if !validAlertTypes[alert.AlertType] {
 		return fmt.Errorf("invalid alert type: %s", alert.AlertType)
@@ -88,7 +94,11 @@ func (c *HerbalTraceContract) CreateAlert(ctx contractapi.TransactionContextInte
 	// Set default values
 	alert.Type = "Alert"
 	alert.Status = "active"
-	alert.Timestamp = time.Now().Format(time.RFC3339)
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+	alert.Timestamp = txTime.Format(time.RFC3339)
 	if alert.CreatedBy == "" {
 		alert.CreatedBy = "system"
 	}
@@ -226,13 +236,16 @@ func (c *HerbalTraceContract) GetAlertsByEntity(ctx contractapi.TransactionConte
 	return c.queryAlerts(ctx, queryString)
 }
 
-// AcknowledgeAlert marks an alert as acknowledged by a user
+// AcknowledgeAlert marks an alert as acknowledged by the submitting user.
+// A non-empty userID must match the submitter's enrollment ID; the submitter's MSP ID is recorded with it.
 func (c *HerbalTraceContract) AcknowledgeAlert(ctx contractapi.TransactionContextInterface, alertID string, userID string) error {
 	if alertID == "" {
 		return fmt.Errorf("alert ID is required")
 	}
-	if userID == "" {
-		return fmt.Errorf("user ID is required")
+
+	identity, userID, err := resolveActor(ctx, userID, false)
+	if err != nil {
+		return err
 	}
 
 	// Get existing alert
@@ -249,7 +262,12 @@ func (c *HerbalTraceContract) AcknowledgeAlert(ctx contractapi.TransactionContex
 	// Update alert
 	alert.Status = "acknowledged"
 	alert.AcknowledgedBy = userID
-	alert.AcknowledgedDate = time.Now().Format(time.RFC3339)
+	alert.AcknowledgedByMSP = identity.MSPID
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+	alert.AcknowledgedDate = txTime.Format(time.RFC3339)
 
 	// Save updated alert
 	alertBytes, err := json.Marshal(alert)
@@ -275,18 +293,21 @@ func (c *HerbalTraceContract) AcknowledgeAlert(ctx contractapi.TransactionContex
 	return nil
 }
 
-// ResolveAlert marks an alert as resolved with a resolution note
+// ResolveAlert marks an alert as resolved with a resolution note.
+// A non-empty userID must match the submitter's enrollment ID; the submitter's MSP ID is recorded with it.
 func (c *HerbalTraceContract) ResolveAlert(ctx contractapi.TransactionContextInterface, alertID string, userID string, resolution string) error {
 	if alertID == "" {
 		return fmt.Errorf("alert ID is required")
 	}
-	if userID == "" {
-		return fmt.Errorf("user ID is required")
-	}
 	if resolution == "" {
 		return fmt.Errorf("resolution is required")
 	}
 
+	identity, userID, err := resolveActor(ctx, userID, false)
+	if err != nil {
+		return err
+	}
+
 	// Get existing alert
 	alert, err := c.GetAlert(ctx, alertID)
 	if err != nil {
@@ -301,12 +322,18 @@ func (c *HerbalTraceContract) ResolveAlert(ctx contractapi.TransactionContextInt
 	// Update alert
 	alert.Status = "resolved"
 	alert.ResolvedBy = userID
-	alert.ResolvedDate = time.Now().Format(time.RFC3339)
+	alert.ResolvedByMSP = identity.MSPID
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+	alert.ResolvedDate = txTime.Format(time.RFC3339)
 	alert.Resolution = resolution
 
 	// If not acknowledged yet, acknowledge it automatically
 	if alert.AcknowledgedBy == "" {
 		alert.AcknowledgedBy = userID
+		alert.AcknowledgedByMSP = identity.MSPID
 		alert.AcknowledgedDate = alert.ResolvedDate
 	}
 
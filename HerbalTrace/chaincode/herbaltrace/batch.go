@@ -3,6 +3,7 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"time"
 
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
@@ -10,20 +11,27 @@ import (
 
 // Batch represents a collection of harvested materials aggregated for processing
 type Batch struct {
-	ID                 string   `json:"id"`
-	Type               string   `json:"type"` // "Batch"
-	Species            string   `json:"species"`
-	TotalQuantity      float64  `json:"totalQuantity"`
-	Unit               string   `json:"unit"`
-	CollectionEventIDs []string `json:"collectionEventIds"`
-	AssignedProcessor  string   `json:"assignedProcessor,omitempty"`
-	ProcessorName      string   `json:"processorName,omitempty"`
-	Status             string   `json:"status"` // "collected", "assigned", "testing", "processing", "manufactured"
-	CreatedDate        string   `json:"createdDate"`
-	CreatedBy          string   `json:"createdBy"` // Farmer ID
-	AssignedDate       string   `json:"assignedDate,omitempty"`
-	AssignedBy         string   `json:"assignedBy,omitempty"` // Admin ID
-	Timestamp          string   `json:"timestamp"`
+	ID                        string   `json:"id"`
+	Type                      string   `json:"type"` // "Batch"
+	Species                   string   `json:"species"`
+	TotalQuantity             float64  `json:"totalQuantity"`
+	Unit                      string   `json:"unit"`
+	CanonicalQuantity         float64  `json:"canonicalQuantity"` // Total quantity in the canonical unit (kg or l)
+	CanonicalUnit             string   `json:"canonicalUnit"`
+	CollectionEventIDs        []string `json:"collectionEventIds"`
+	AssignedProcessor         string   `json:"assignedProcessor,omitempty"`
+	ProcessorName             string   `json:"processorName,omitempty"`
+	Status                    string   `json:"status"` // "collected", "assigned", "testing", "processing", "manufactured"
+	CreatedDate               string   `json:"createdDate"`
+	CreatedBy                 string   `json:"createdBy"`              // Farmer ID
+	SubmittedBy               string   `json:"submittedBy,omitempty"`  // Enrollment ID of the submitting identity
+	SubmitterMSP              string   `json:"submitterMsp,omitempty"` // MSP ID of the submitting identity
+	AssignedDate              string   `json:"assignedDate,omitempty"`
+	AssignedBy                string   `json:"assignedBy,omitempty"`                // Admin ID
+	AssignedByMSP             string   `json:"assignedByMsp,omitempty"`             // MSP ID of the assigning admin
+	CommercialTermsCollection string   `json:"commercialTermsCollection,omitempty"` // Private collection holding the agreed terms
+	CommercialTermsHash       string   `json:"commercialTermsHash,omitempty"`       // SHA-256 of the private terms
+	Timestamp                 string   `json:"timestamp"`
 }
 
 // BatchHistory represents the complete timeline of a batch
@@ -55,10 +63,40 @@ func (c *HerbalTraceContract) CreateBatch(ctx contractapi.TransactionContextInte
 	if batch.Unit == "" {
 		return fmt.Errorf("unit is required")
 	}
-	if batch.CreatedBy == "" {
-		return fmt.Errorf("created by (farmer ID) is required")
+	batch.Species, err = c.normalizeSpecies(ctx, batch.Species)
+	if err != nil {
+		return err
+	}
+	batch.CanonicalQuantity, batch.CanonicalUnit, err = toCanonical(batch.TotalQuantity, batch.Unit)
+	if err != nil {
+		return err
 	}
 
+	if len(batch.CollectionEventIDs) == 0 {
+		return fmt.Errorf("at least one collection event is required")
+	}
+
+	// Bind the creator to the submitting identity (admins may create on behalf of a farmer)
+	submitter, createdBy, err := resolveActor(ctx, batch.CreatedBy, true)
+	if err != nil {
+		return err
+	}
+	batch.CreatedBy = createdBy
+	batch.SubmittedBy = submitter.EnrollmentID
+	batch.SubmitterMSP = submitter.MSPID
+
+	// Only verified collection events of the farmer or their cooperative may be batched, and the total
+	// must match them in the canonical unit
+	events, collected, err := c.loadBatchCollectionEvents(ctx, &batch)
+	if err != nil {
+		return err
+	}
+	if math.Abs(collected-batch.CanonicalQuantity) > quantityTolerance {
+		return fmt.Errorf("batch total %.3f %s (%.3f %s) does not match the %.3f %s collected in its events",
+			batch.TotalQuantity, batch.Unit, batch.CanonicalQuantity, batch.CanonicalUnit, collected, batch.CanonicalUnit)
+	}
+	batch.CanonicalQuantity = collected
+
 	// Check if batch already exists
 	existingBatch, err := ctx.GetStub().GetState(batch.ID)
 	if err != nil {
@@ -71,13 +109,12 @@ func (c *HerbalTraceContract) CreateBatch(ctx contractapi.TransactionContextInte
 	// Set default values
 	batch.Type = "Batch"
 	batch.Status = "collected"
-	batch.CreatedDate = time.Now().Format(time.RFC3339)
-	batch.Timestamp = time.Now().Format(time.RFC3339)
-
-	// Initialize collection event IDs if not provided
-	if batch.CollectionEventIDs == nil {
-		batch.CollectionEventIDs = []string{}
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
 	}
+	batch.CreatedDate = txTime.Format(time.RFC3339)
+	batch.Timestamp = txTime.Format(time.RFC3339)
 
 	// Save batch to ledger
 	batchBytes, err := json.Marshal(batch)
@@ -90,15 +127,30 @@ func (c *HerbalTraceContract) CreateBatch(ctx contractapi.TransactionContextInte
 		return fmt.Errorf("failed to save batch to ledger: %v", err)
 	}
 
+	// Only the farmer cooperative may endorse changes until the batch is assigned
+	if err := setKeyEndorsement(ctx, batch.ID, c.batchFarmerOrg(ctx, &batch)); err != nil {
+		return err
+	}
+
+	// Link the collection events to the batch so that they cannot be batched again
+	for _, event := range events {
+		event.BatchID = batch.ID
+		if err := c.putCollectionEvent(ctx, event); err != nil {
+			return err
+		}
+	}
+
 	// Emit event
 	eventPayload := map[string]interface{}{
-		"eventType": "BatchCreated",
-		"batchId":   batch.ID,
-		"species":   batch.Species,
-		"quantity":  batch.TotalQuantity,
-		"unit":      batch.Unit,
-		"createdBy": batch.CreatedBy,
-		"timestamp": batch.Timestamp,
+		"eventType":         "BatchCreated",
+		"batchId":           batch.ID,
+		"species":           batch.Species,
+		"quantity":          batch.TotalQuantity,
+		"unit":              batch.Unit,
+		"canonicalQuantity": batch.CanonicalQuantity,
+		"canonicalUnit":     batch.CanonicalUnit,
+		"createdBy":         batch.CreatedBy,
+		"timestamp":         batch.Timestamp,
 	}
 	eventBytes, _ := json.Marshal(eventPayload)
 	ctx.GetStub().SetEvent("BatchCreated", eventBytes)
@@ -106,6 +158,63 @@ func (c *HerbalTraceContract) CreateBatch(ctx contractapi.TransactionContextInte
 	return nil
 }
 
+// loadBatchCollectionEvents reads a batch's collection events and adds up their canonical quantities.
+// The events must be verified, not yet in a batch, of the batch species, collected by the batch farmer
+// or another farmer of their cooperative, and measured in the same dimension as the batch.
+func (c *HerbalTraceContract) loadBatchCollectionEvents(ctx contractapi.TransactionContextInterface, batch *Batch) ([]*CollectionEvent, float64, error) {
+	farmerOrg := c.batchFarmerOrg(ctx, batch)
+	var events []*CollectionEvent
+	total := 0.0
+	for i, eventID := range batch.CollectionEventIDs {
+		if containsString(batch.CollectionEventIDs[:i], eventID) {
+			return nil, 0, fmt.Errorf("collection event %s is listed more than once", eventID)
+		}
+		event, err := c.GetCollectionEvent(ctx, eventID)
+		if err != nil {
+			return nil, 0, err
+		}
+		if event.Type != "CollectionEvent" {
+			return nil, 0, fmt.Errorf("%s is not a collection event", eventID)
+		}
+		if event.Status != "verified" {
+			return nil, 0, fmt.Errorf("collection event %s is %s; only verified events can be batched", eventID, event.Status)
+		}
+		if event.BatchID != "" {
+			return nil, 0, fmt.Errorf("collection event %s is already in batch %s", eventID, event.BatchID)
+		}
+		if event.Species != batch.Species {
+			return nil, 0, fmt.Errorf("collection event %s is of species %s, not %s", eventID, event.Species, batch.Species)
+		}
+		if event.FarmerID != batch.CreatedBy {
+			farmer, err := c.GetParticipant(ctx, event.FarmerID)
+			if err != nil {
+				return nil, 0, err
+			}
+			if farmer.Organization != farmerOrg {
+				return nil, 0, fmt.Errorf("collection event %s was collected by farmer %s of %s, not by farmer %s or their cooperative %s",
+					eventID, event.FarmerID, farmer.Organization, batch.CreatedBy, farmerOrg)
+			}
+		}
+
+		// Events recorded before canonical quantities were introduced are converted here
+		quantity, unit := event.CanonicalQuantity, event.CanonicalUnit
+		if unit == "" {
+			quantity, unit, err = toCanonical(event.Quantity, event.Unit)
+			if err != nil {
+				return nil, 0, fmt.Errorf("collection event %s: %v", eventID, err)
+			}
+		}
+		if unit != batch.CanonicalUnit {
+			return nil, 0, fmt.Errorf("incompatible units: collection event %s is measured in %s, batch %s in %s",
+				eventID, event.Unit, batch.ID, batch.Unit)
+		}
+		total += quantity
+		events = append(events, event)
+	}
+
+	return events, roundQuantity(total), nil
+}
+
 // GetBatch retrieves a batch by ID
 func (c *HerbalTraceContract) GetBatch(ctx contractapi.TransactionContextInterface, batchID string) (*Batch, error) {
 	if batchID == "" {
@@ -129,7 +238,10 @@ func (c *HerbalTraceContract) GetBatch(ctx contractapi.TransactionContextInterfa
 	return &batch, nil
 }
 
-// AssignBatchToProcessor assigns a batch to a processor (admin function)
+// AssignBatchToProcessor assigns a batch to a processor (admin function).
+// The admin ID is taken from the submitting identity; a non-empty adminID must match it.
+// From then on the batch key requires endorsement by peers of both the farmer cooperative and the
+// processor's organization, so every later UpdateBatchStatus must be endorsed by both.
 func (c *HerbalTraceContract) AssignBatchToProcessor(ctx contractapi.TransactionContextInterface, batchID string, processorID string, processorName string, adminID string) error {
 	if batchID == "" {
 		return fmt.Errorf("batch ID is required")
@@ -137,8 +249,14 @@ func (c *HerbalTraceContract) AssignBatchToProcessor(ctx contractapi.Transaction
 	if processorID == "" {
 		return fmt.Errorf("processor ID is required")
 	}
-	if adminID == "" {
-		return fmt.Errorf("admin ID is required")
+
+	admin, adminID, err := resolveActor(ctx, adminID, false)
+	if err != nil {
+		return err
+	}
+	processor, err := c.requireActiveParticipant(ctx, processorID, RoleProcessor)
+	if err != nil {
+		return err
 	}
 
 	// Get existing batch
@@ -156,9 +274,14 @@ func (c *HerbalTraceContract) AssignBatchToProcessor(ctx contractapi.Transaction
 	batch.AssignedProcessor = processorID
 	batch.ProcessorName = processorName
 	batch.AssignedBy = adminID
-	batch.AssignedDate = time.Now().Format(time.RFC3339)
+	batch.AssignedByMSP = admin.MSPID
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+	batch.AssignedDate = txTime.Format(time.RFC3339)
 	batch.Status = "assigned"
-	batch.Timestamp = time.Now().Format(time.RFC3339)
+	batch.Timestamp = txTime.Format(time.RFC3339)
 
 	// Save updated batch
 	batchBytes, err := json.Marshal(batch)
@@ -171,13 +294,25 @@ func (c *HerbalTraceContract) AssignBatchToProcessor(ctx contractapi.Transaction
 		return fmt.Errorf("failed to update batch: %v", err)
 	}
 
-	// Emit event
+	// After assignment both the farmer cooperative and the processor must endorse batch changes
+	if err := setKeyEndorsement(ctx, batchID, c.batchFarmerOrg(ctx, batch), processor.Organization); err != nil {
+		return err
+	}
+
+	// Commercial terms, if supplied, stay private to the farmer cooperative and the processor
+	hasTerms, err := c.putBatchCommercialTerms(ctx, batch)
+	if err != nil {
+		return err
+	}
+
+	// Emit event (Fabric keeps one event per transaction, so this also reports whether terms were set)
 	eventPayload := map[string]interface{}{
 		"eventType":    "BatchAssigned",
 		"batchId":      batchID,
 		"processorId":  processorID,
 		"processorName": processorName,
 		"assignedBy":   adminID,
+		"hasCommercialTerms": hasTerms,
 		"timestamp":    batch.Timestamp,
 	}
 	eventBytes, _ := json.Marshal(eventPayload)
@@ -186,7 +321,9 @@ func (c *HerbalTraceContract) AssignBatchToProcessor(ctx contractapi.Transaction
 	return nil
 }
 
-// UpdateBatchStatus updates the status of a batch
+// UpdateBatchStatus updates the status of a batch. Once the batch is assigned, the transaction (and
+// any quality test, processing step or product that advances the status) must be endorsed by peers
+// of both the farmer cooperative and the processor's organization; see AssignBatchToProcessor.
 func (c *HerbalTraceContract) UpdateBatchStatus(ctx contractapi.TransactionContextInterface, batchID string, newStatus string) error {
 	if batchID == "" {
 		return fmt.Errorf("batch ID is required")
@@ -216,7 +353,11 @@ func (c *HerbalTraceContract) UpdateBatchStatus(ctx contractapi.TransactionConte
 	// Update status
 	oldStatus := batch.Status
 	batch.Status = newStatus
-	batch.Timestamp = time.Now().Format(time.RFC3339)
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+	batch.Timestamp = txTime.Format(time.RFC3339)
 
 	// Save updated batch
 	batchBytes, err := json.Marshal(batch)
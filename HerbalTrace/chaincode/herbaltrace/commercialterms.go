@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// commercialTermsTransientKey is the transient map key carrying BatchCommercialTerms
+const commercialTermsTransientKey = "commercialTerms"
+
+// BatchCommercialTerms holds the price and contract terms agreed between a farmer cooperative and a
+// processor for a batch. It is stored only in the private collection shared by that pair of orgs.
+type BatchCommercialTerms struct {
+	BatchID           string  `json:"batchId"`
+	FarmerOrg         string  `json:"farmerOrg"`
+	ProcessorID       string  `json:"processorId"`
+	ProcessorOrg      string  `json:"processorOrg"`
+	PricePerUnit      float64 `json:"pricePerUnit"`
+	Currency          string  `json:"currency"` // "INR"
+	Unit              string  `json:"unit"`
+	PaymentTerms      string  `json:"paymentTerms"` // e.g. "Net 30"
+	ContractReference string  `json:"contractReference,omitempty"`
+	Salt              string  `json:"salt"` // Client-generated random salt
+	UpdatedBy         string  `json:"updatedBy"`
+	UpdatedAt         string  `json:"updatedAt"`
+}
+
+// commercialTermsCollection returns the private collection shared by a farmer cooperative and a processor org
+func commercialTermsCollection(farmerOrg string, processorOrg string) string {
+	return fmt.Sprintf("commercialTerms_%s_%s", farmerOrg, processorOrg)
+}
+
+// SetBatchCommercialTerms stores or replaces the commercial terms of an assigned batch.
+// The terms are read from the "commercialTerms" transient field.
+func (c *HerbalTraceContract) SetBatchCommercialTerms(ctx contractapi.TransactionContextInterface, batchID string) error {
+	batch, err := c.GetBatch(ctx, batchID)
+	if err != nil {
+		return err
+	}
+
+	found, err := c.putBatchCommercialTerms(ctx, batch)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("commercial terms are required in the %s transient field", commercialTermsTransientKey)
+	}
+
+	return nil
+}
+
+// GetBatchCommercialTerms retrieves the commercial terms of a batch for members of the farmer cooperative
+// or the assigned processor's organization
+func (c *HerbalTraceContract) GetBatchCommercialTerms(ctx contractapi.TransactionContextInterface, batchID string) (*BatchCommercialTerms, error) {
+	batch, err := c.GetBatch(ctx, batchID)
+	if err != nil {
+		return nil, err
+	}
+	if batch.CommercialTermsCollection == "" {
+		return nil, fmt.Errorf("batch %s has no commercial terms", batchID)
+	}
+
+	processor, err := c.GetParticipant(ctx, batch.AssignedProcessor)
+	if err != nil {
+		return nil, err
+	}
+	identity, err := getClientIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if identity.MSPID != c.batchFarmerOrg(ctx, batch) && identity.MSPID != processor.Organization {
+		return nil, fmt.Errorf("access denied: %s is not a party to the commercial terms of batch %s", identity.MSPID, batchID)
+	}
+
+	termsBytes, err := ctx.GetStub().GetPrivateData(batch.CommercialTermsCollection, batchID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read commercial terms: %v", err)
+	}
+	if termsBytes == nil {
+		return nil, fmt.Errorf("commercial terms for batch %s are not available on this peer", batchID)
+	}
+
+	var terms BatchCommercialTerms
+	err = json.Unmarshal(termsBytes, &terms)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal commercial terms: %v", err)
+	}
+
+	return &terms, nil
+}
+
+// VerifyBatchCommercialTerms checks that commercial terms supplied by an auditor match the salted hash
+// on the public batch and the hash of the private data committed to the ledger
+func (c *HerbalTraceContract) VerifyBatchCommercialTerms(ctx contractapi.TransactionContextInterface, batchID string, termsJSON string) (bool, error) {
+	batch, err := c.GetBatch(ctx, batchID)
+	if err != nil {
+		return false, err
+	}
+	if batch.CommercialTermsHash == "" {
+		return false, fmt.Errorf("batch %s has no commercial terms", batchID)
+	}
+
+	var terms BatchCommercialTerms
+	err = json.Unmarshal([]byte(termsJSON), &terms)
+	if err != nil {
+		return false, fmt.Errorf("failed to unmarshal commercial terms: %v", err)
+	}
+
+	// Re-serialize in canonical field order before hashing
+	termsBytes, err := json.Marshal(terms)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal commercial terms: %v", err)
+	}
+	if privateDataHash(termsBytes) != batch.CommercialTermsHash {
+		return false, nil
+	}
+
+	ledgerHash, err := ctx.GetStub().GetPrivateDataHash(batch.CommercialTermsCollection, batchID)
+	if err != nil {
+		return false, fmt.Errorf("failed to read private data hash: %v", err)
+	}
+	if ledgerHash == nil {
+		return true, nil
+	}
+
+	return hex.EncodeToString(ledgerHash) == batch.CommercialTermsHash, nil
+}
+
+// putBatchCommercialTerms stores commercial terms from the transient map, if present, in the collection
+// shared by the batch's farmer cooperative and assigned processor, and records their hash on the batch.
+// Only members of those two organizations may set the terms. It returns false when no terms were supplied.
+func (c *HerbalTraceContract) putBatchCommercialTerms(ctx contractapi.TransactionContextInterface, batch *Batch) (bool, error) {
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return false, fmt.Errorf("failed to read transient data: %v", err)
+	}
+	termsJSON, ok := transientMap[commercialTermsTransientKey]
+	if !ok || len(termsJSON) == 0 {
+		return false, nil
+	}
+
+	if batch.AssignedProcessor == "" {
+		return false, fmt.Errorf("batch %s must be assigned to a processor before commercial terms are set", batch.ID)
+	}
+	processor, err := c.GetParticipant(ctx, batch.AssignedProcessor)
+	if err != nil {
+		return false, err
+	}
+
+	var terms BatchCommercialTerms
+	err = json.Unmarshal(termsJSON, &terms)
+	if err != nil {
+		return false, fmt.Errorf("failed to unmarshal commercial terms: %v", err)
+	}
+	if terms.PricePerUnit <= 0 {
+		return false, fmt.Errorf("price per unit must be greater than zero")
+	}
+	if terms.Currency == "" {
+		return false, fmt.Errorf("currency is required")
+	}
+	if len(terms.Salt) < minPrivateSaltLength {
+		return false, fmt.Errorf("commercial terms salt must be at least %d characters", minPrivateSaltLength)
+	}
+
+	identity, err := getClientIdentity(ctx)
+	if err != nil {
+		return false, err
+	}
+	farmerOrg := c.batchFarmerOrg(ctx, batch)
+	if identity.MSPID != farmerOrg && identity.MSPID != processor.Organization {
+		return false, fmt.Errorf("access denied: %s is not a party to the commercial terms of batch %s", identity.MSPID, batch.ID)
+	}
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	terms.BatchID = batch.ID
+	terms.FarmerOrg = farmerOrg
+	terms.ProcessorID = processor.ID
+	terms.ProcessorOrg = processor.Organization
+	if terms.Unit == "" {
+		terms.Unit = batch.Unit
+	}
+	terms.UpdatedBy = identity.EnrollmentID
+	terms.UpdatedAt = txTime.Format(time.RFC3339)
+
+	termsBytes, err := json.Marshal(terms)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal commercial terms: %v", err)
+	}
+
+	collection := commercialTermsCollection(terms.FarmerOrg, terms.ProcessorOrg)
+	err = ctx.GetStub().PutPrivateData(collection, batch.ID, termsBytes)
+	if err != nil {
+		return false, fmt.Errorf("failed to save commercial terms: %v", err)
+	}
+
+	// Record only the link and hash on the public batch
+	batch.CommercialTermsCollection = collection
+	batch.CommercialTermsHash = privateDataHash(termsBytes)
+	batch.Timestamp = terms.UpdatedAt
+
+	batchBytes, err := json.Marshal(batch)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal batch: %v", err)
+	}
+	err = ctx.GetStub().PutState(batch.ID, batchBytes)
+	if err != nil {
+		return false, fmt.Errorf("failed to update batch: %v", err)
+	}
+
+	// Emit event revealing only that terms exist
+	eventPayload := map[string]interface{}{
+		"eventType":   "BatchCommercialTermsSet",
+		"batchId":     batch.ID,
+		"processorId": processor.ID,
+		"termsHash":   batch.CommercialTermsHash,
+		"timestamp":   terms.UpdatedAt,
+	}
+	eventBytes, _ := json.Marshal(eventPayload)
+	ctx.GetStub().SetEvent("BatchCommercialTermsSet", eventBytes)
+
+	return true, nil
+}
@@ -0,0 +1,471 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// ComplianceViolation is a failed compliance check of a collection event
+type ComplianceViolation struct {
+	Code    string `json:"code"` // e.g. "zone_violation", "season_violation", "over_harvest", "quota_exceeded"
+	Message string `json:"message"`
+	AlertID string `json:"alertId,omitempty"` // Alert raised for the violation
+}
+
+// CollectionEventResult tells the client how a submitted collection event was recorded
+type CollectionEventResult struct {
+	EventID    string                `json:"eventId"`
+	Accepted   bool                  `json:"accepted"`
+	Status     string                `json:"status"` // "pending", "pending_review", "rejected"
+	Violations []ComplianceViolation `json:"violations,omitempty"`
+	AlertIDs   []string              `json:"alertIds,omitempty"`
+}
+
+// CollectionEventValidation is the outcome of a dry run of CreateCollectionEvent
+type CollectionEventValidation struct {
+	EventID    string                `json:"eventId"`
+	Valid      bool                  `json:"valid"`
+	Status     string                `json:"status"` // Status the event would be recorded with: "pending", "pending_review", "rejected"
+	Violations []ComplianceViolation `json:"violations"`
+	Warnings   []ComplianceViolation `json:"warnings"` // Flags and collector activity anomalies that do not refuse the event
+}
+
+// collectionAssessment holds the outcome of the compliance checks of a collection event: the
+// violations and alerts, and the ledger updates to apply if the event is accepted
+type collectionAssessment struct {
+	Violations []ComplianceViolation
+	AlertIDs   []string
+	Warnings   []ComplianceViolation // Flags and anomalies that raise an alert without refusing the event
+	alerts     []string              // Alert JSON, created by the caller
+
+	zone    *ApprovedZone
+	season  string
+	quotas  []*HarvestLimit
+	permit  *HarvestPermit     // Debited permit to save
+	usage   *ConservationUsage // Conservation usage to save
+	suspect bool               // Collector activity anomalies hold the event for review
+}
+
+// alert queues a collection event alert
+func (a *collectionAssessment) alert(alertID string, alertType string, severity string, event *CollectionEvent, message string, details string) {
+	alertJSON, _ := json.Marshal(Alert{
+		ID:         alertID,
+		AlertType:  alertType,
+		Severity:   severity,
+		EntityID:   event.ID,
+		EntityType: "CollectionEvent",
+		Species:    event.Species,
+		Zone:       event.ZoneName,
+		Message:    message,
+		Details:    details,
+	})
+	a.alerts = append(a.alerts, string(alertJSON))
+	a.AlertIDs = append(a.AlertIDs, alertID)
+}
+
+// violate records a violation and queues its alert
+func (a *collectionAssessment) violate(code string, alertID string, alertType string, severity string, event *CollectionEvent, message string, details string) {
+	a.Violations = append(a.Violations, ComplianceViolation{Code: code, Message: details, AlertID: alertID})
+	a.alert(alertID, alertType, severity, event, message, details)
+}
+
+// warn records a warning and queues its alert
+func (a *collectionAssessment) warn(code string, alertID string, alertType string, severity string, event *CollectionEvent, message string, details string) {
+	a.Warnings = append(a.Warnings, ComplianceViolation{Code: code, Message: details, AlertID: alertID})
+	a.alert(alertID, alertType, severity, event, message, details)
+}
+
+// ValidateCollectionEvent runs every check of CreateCollectionEvent on a collection event without
+// writing to the ledger or consuming harvest limits, quotas or permits, and returns all violations.
+// It takes the same arguments and transient private details as CreateCollectionEvent; the event ID
+// may be left empty. An unknown, suspended or unverified farmer and missing private details are
+// reported as violations rather than errors. The compliance checks need a registered species and the
+// private coordinates; the quantity checks are skipped when the quantity or unit is invalid, and the
+// collector activity checks when the capture time is invalid.
+func (c *HerbalTraceContract) ValidateCollectionEvent(ctx contractapi.TransactionContextInterface, eventJSON string) (*CollectionEventValidation, error) {
+	var event CollectionEvent
+	err := json.Unmarshal([]byte(eventJSON), &event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal event: %v", err)
+	}
+
+	result := CollectionEventValidation{
+		EventID:    event.ID,
+		Violations: []ComplianceViolation{},
+		Warnings:   []ComplianceViolation{},
+	}
+	if event.ID != "" {
+		existingEvent, err := ctx.GetStub().GetState(event.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check if collection event exists: %v", err)
+		}
+		if existingEvent != nil {
+			result.Violations = append(result.Violations, ComplianceViolation{
+				Code:    "duplicate_event",
+				Message: fmt.Sprintf("collection event %s already exists", event.ID),
+			})
+		}
+	}
+
+	submitter, farmerID, err := resolveActor(ctx, event.FarmerID, true)
+	if err != nil {
+		return nil, err
+	}
+	event.FarmerID = farmerID
+	event.SubmittedBy = submitter.EnrollmentID
+	event.SubmitterMSP = submitter.MSPID
+	farmer, err := c.requireActiveParticipant(ctx, event.FarmerID, RoleFarmer)
+	if err != nil {
+		result.Violations = append(result.Violations, ComplianceViolation{Code: "farmer_refused", Message: err.Error()})
+		// Keep checking against the quotas of the claimed farmer and the submitting cooperative
+		farmer = &Participant{ID: event.FarmerID, Role: RoleFarmer, Organization: submitter.MSPID}
+	}
+	hasLocation := true
+	if _, err := readCollectionPrivateDetails(ctx, &event); err != nil {
+		result.Violations = append(result.Violations, ComplianceViolation{Code: "invalid_private_details", Message: err.Error()})
+		hasLocation = false
+	}
+
+	submittedAt, err := getTxTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	species, inputViolations, err := c.checkCollectionInput(ctx, &event, submittedAt)
+	if err != nil {
+		return nil, err
+	}
+	result.Violations = append(result.Violations, inputViolations...)
+
+	resetCollectionEvent(&event)
+	if species != nil && hasLocation {
+		assessment, err := c.assessCollectionEvent(ctx, &event, farmer, species)
+		if err != nil {
+			return nil, err
+		}
+		for _, violation := range assessment.Violations {
+			violation.AlertID = ""
+			result.Violations = append(result.Violations, violation)
+		}
+		for _, warning := range assessment.Warnings {
+			warning.AlertID = ""
+			result.Warnings = append(result.Warnings, warning)
+		}
+		if assessment.suspect {
+			event.Status = "pending_review"
+		}
+	}
+
+	result.Valid = len(result.Violations) == 0
+	result.Status = event.Status
+	if !result.Valid {
+		result.Status = "rejected"
+	}
+
+	return &result, nil
+}
+
+// checkCollectionInput checks the submitted data of a collection event: the farmer device signature,
+// the capture time, the species and collected part, and the quantity and unit. It sets the submission
+// and capture times, the registry species fields and the canonical quantity. The species is nil when
+// it is not registered; the canonical unit and capture time are left empty when they are invalid.
+func (c *HerbalTraceContract) checkCollectionInput(ctx contractapi.TransactionContextInterface, event *CollectionEvent, submittedAt time.Time) (*Species, []ComplianceViolation, error) {
+	var violations []ComplianceViolation
+	violate := func(code string, message string) {
+		violations = append(violations, ComplianceViolation{Code: code, Message: message})
+	}
+
+	// Verify the farmer device signature over the captured data, then record capture and submission times
+	event.SignatureVerified = false
+	if event.FarmerSignature != "" {
+		if event.CapturedAt == "" {
+			violate("signature_rejected", "capture time is required for signed collection events")
+		} else {
+			signatureIssue, err := c.verifyFarmerSignature(ctx, *event)
+			if err != nil {
+				return nil, nil, fmt.Errorf("signature verification error: %v", err)
+			}
+			if signatureIssue != "" {
+				violate("signature_rejected", fmt.Sprintf("farmer signature rejected for event %s: %s", event.ID, signatureIssue))
+			} else {
+				event.SignatureVerified = true
+			}
+		}
+	}
+	event.SubmittedAt = submittedAt.Format(time.RFC3339)
+	if event.CapturedAt == "" {
+		event.CapturedAt = event.SubmittedAt
+	}
+	capturedAt, err := time.Parse(time.RFC3339, event.CapturedAt)
+	if err != nil {
+		violate("invalid_capture_time", fmt.Sprintf("invalid capture time format: %v", err))
+		event.CapturedAt = ""
+	} else if capturedAt.After(submittedAt.Add(maxCaptureClockSkew)) {
+		violate("invalid_capture_time", fmt.Sprintf("capture time %s is after submission time %s", event.CapturedAt, event.SubmittedAt))
+		event.CapturedAt = ""
+	}
+
+	// Normalize the species against the registry (after signature verification, which covers the submitted name)
+	species, err := c.ResolveSpecies(ctx, event.Species)
+	if err != nil {
+		violate("unknown_species", err.Error())
+		species = nil
+	} else {
+		if !species.permitsPart(event.PartCollected) {
+			violate("part_not_permitted", fmt.Sprintf("part %q may not be collected for species %s; permitted parts: %s",
+				event.PartCollected, species.ID, strings.Join(species.PermittedParts, ", ")))
+		}
+		event.Species = species.ID
+		event.ScientificName = species.ScientificName
+		if event.CommonName == "" {
+			event.CommonName = species.CommonName
+		}
+		event.ConservationStatus = species.ConservationCategory
+	}
+
+	// Record the quantity in the canonical unit; limits, quotas, caps and permits are checked in it
+	event.CanonicalQuantity, event.CanonicalUnit = 0, ""
+	if event.Quantity <= 0 {
+		violate("invalid_quantity", "quantity must be greater than zero")
+	} else if event.CanonicalQuantity, event.CanonicalUnit, err = toCanonical(event.Quantity, event.Unit); err != nil {
+		violate("invalid_unit", err.Error())
+	}
+
+	return species, violations, nil
+}
+
+// resetCollectionEvent sets the type and the "pending" status of a new collection event and clears
+// the review, batch and compliance fields that only the chaincode sets
+func resetCollectionEvent(event *CollectionEvent) {
+	event.Type = "CollectionEvent"
+	event.Status = "pending"
+	event.Reviews = nil
+	event.BatchID = ""
+	event.Violations = nil
+	event.LocationFlags = nil
+	event.ApprovedZone = false
+	event.ApprovedZoneID = ""
+	event.ApprovedZoneVersion = 0
+	event.SeasonWindowID = ""
+}
+
+// assessCollectionEvent runs every compliance check of a collection event without writing to the
+// ledger: GPS plausibility, geo-fencing, season window, harvest limit and quotas, harvest permit,
+// conservation status and collector activity. Checks that depend on the zone are skipped when the
+// location matches no approved zone, the quantity checks without a canonical quantity and the collector
+// activity checks without a capture time. It fills the event's zone, season window, location flags and
+// conservation status.
+func (c *HerbalTraceContract) assessCollectionEvent(ctx contractapi.TransactionContextInterface, event *CollectionEvent, farmer *Participant, species *Species) (*collectionAssessment, error) {
+	a := &collectionAssessment{}
+
+	// 1. Check that the GPS fix is plausible, then validate geo-fencing against the approved zone
+	// registry and resolve the zone from the location
+	locationIssues, err := c.checkLocationPlausibility(ctx, event, species)
+	if err != nil {
+		return nil, fmt.Errorf("location validation error: %v", err)
+	}
+	for _, issue := range locationIssues {
+		alertID := fmt.Sprintf("alert_%s_%s", issue.Code, event.ID)
+		if issue.Reject {
+			a.violate(issue.Code, alertID, issue.AlertType, issue.Severity, event, issue.Message, issue.Details)
+		} else {
+			a.alert(alertID, issue.AlertType, issue.Severity, event, issue.Message, issue.Details)
+		}
+		event.LocationFlags = append(event.LocationFlags, issue.AlertType)
+	}
+
+	zones, err := c.validateGeoFencing(ctx, event)
+	if err != nil {
+		return nil, fmt.Errorf("geo-fencing validation error: %v", err)
+	}
+	if len(zones) == 0 {
+		a.violate("zone_violation", "alert_zone_"+event.ID, "zone_violation", "high", event,
+			"Collection location outside approved zone",
+			fmt.Sprintf("Harvest location of event %s (accuracy %.0fm) is outside every approved zone for species %s on %s",
+				event.ID, event.Accuracy, event.Species, event.HarvestDate))
+	} else if a.zone = resolveZone(zones, event.ZoneName); a.zone == nil {
+		a.violate("zone_mismatch", "alert_zone_"+event.ID, "zone_violation", "high", event,
+			"Claimed zone does not match collection location",
+			fmt.Sprintf("Event %s claims zone %s but its location lies in %s", event.ID, event.ZoneName, zones[0].Name))
+	} else {
+		event.ZoneName = a.zone.Name
+		event.ApprovedZone = true
+		event.ApprovedZoneID = a.zone.ZoneID
+		event.ApprovedZoneVersion = a.zone.Version
+	}
+
+	if a.zone != nil {
+		// 2. Validate the season window of the zone region; without a zone the event is already refused
+		seasonResult, err := c.ValidateSeasonWindow(ctx, event.Species, event.HarvestDate, a.zone.Region)
+		if err != nil {
+			return nil, fmt.Errorf("season validation error: %v", err)
+		}
+		if !seasonResult.InSeason {
+			a.violate("season_violation", "alert_season_"+event.ID, "season_violation", "high", event,
+				"Harvest outside allowed season window",
+				fmt.Sprintf("Species %s harvested on %s in %s (region %s) is outside the permitted season window: %s",
+					event.Species, event.HarvestDate, event.ZoneName, a.zone.Region, seasonResult.Reason))
+		}
+		event.SeasonWindowID = seasonResult.WindowID
+
+		// 3-4. Check the quantity against the season's harvest limit and quotas, the harvest permit and
+		// the conservation limits
+		if event.CanonicalUnit != "" {
+			if err := c.assessHarvestQuantity(ctx, event, farmer, a.zone.Region, a); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// 5. Compare the event with the farmer's recent activity
+	if event.CapturedAt != "" {
+		anomalies, err := c.checkCollectorActivity(ctx, event, species)
+		if err != nil {
+			return nil, fmt.Errorf("collector activity validation error: %v", err)
+		}
+		for _, anomaly := range anomalies {
+			a.warn("suspicious_activity", fmt.Sprintf("alert_%s_%s", anomaly.Code, event.ID), "suspicious_activity", "high", event,
+				anomaly.Message, anomaly.Details)
+		}
+		a.suspect = len(anomalies) > 0
+	}
+
+	return a, nil
+}
+
+// assessHarvestQuantity resolves the season of a collection event from the zone region calendar and
+// checks its quantity against the season's harvest limit and quotas, the harvest permit, if any, and
+// the conservation limits of the region
+func (c *HerbalTraceContract) assessHarvestQuantity(ctx contractapi.TransactionContextInterface, event *CollectionEvent, farmer *Participant, region string, a *collectionAssessment) error {
+	// Resolve the season from the zone region calendar, then validate the harvest limit and quotas
+	season, err := c.ResolveSeason(ctx, region, event.HarvestDate)
+	if err != nil {
+		return fmt.Errorf("season resolution error: %v", err)
+	}
+	a.season = season
+	withinLimit, refusal, err := c.checkHarvestLimit(ctx, event.Species, event.ZoneName, a.season, event.CanonicalQuantity, event.CanonicalUnit)
+	if err != nil {
+		return fmt.Errorf("harvest limit validation error: %v", err)
+	}
+	if refusal != "" {
+		a.violate("invalid_unit", "alert_harvest_"+event.ID, "over_harvest", "high", event,
+			"Harvest quantity not comparable with limit", fmt.Sprintf("Event %s refused: %s", event.ID, refusal))
+	} else if !withinLimit {
+		a.violate("over_harvest", "alert_harvest_"+event.ID, "over_harvest", "critical", event,
+			"Harvest limit exceeded",
+			fmt.Sprintf("Attempting to harvest %.2f %s of %s in %s for season %s would exceed the limit",
+				event.Quantity, event.Unit, event.Species, event.ZoneName, a.season))
+	}
+	a.quotas, err = c.applicableQuotas(ctx, event.Species, event.ZoneName, a.season, farmer)
+	if err != nil {
+		return fmt.Errorf("harvest quota validation error: %v", err)
+	}
+	exceeded, refusal := checkHarvestQuotas(a.quotas, event.CanonicalQuantity, event.CanonicalUnit)
+	if refusal != "" {
+		a.violate("invalid_unit", "alert_quota_"+event.ID, "over_harvest", "high", event,
+			"Harvest quantity not comparable with quota", fmt.Sprintf("Event %s refused: %s", event.ID, refusal))
+	} else if exceeded != nil {
+		a.violate("quota_exceeded", "alert_quota_"+event.ID, "over_harvest", "high", event,
+			"Harvest quota exceeded",
+			fmt.Sprintf("Attempting to harvest %.2f %s of %s would exceed %s quota %s (%.2f / %.2f %s used)",
+				event.Quantity, event.Unit, event.Species, exceeded.quotaScope(), exceeded.ID,
+				exceeded.CurrentQuantity, exceeded.MaxQuantity, exceeded.Unit))
+	}
+
+	// Check the harvest permit, if any, then the conservation status for the species and zone region
+	if event.PermitID != "" {
+		permit, refusal, err := c.debitHarvestPermit(ctx, event)
+		if err != nil {
+			return fmt.Errorf("harvest permit validation error: %v", err)
+		}
+		if refusal != "" {
+			a.violate("permit_refused", "alert_permit_"+event.ID, "compliance", "high", event,
+				"Harvest permit refused", fmt.Sprintf("Event %s refused: %s", event.ID, refusal))
+		}
+		a.permit = permit
+	}
+	usage, violation, err := c.validateConservationLimits(ctx, event, region, a.season)
+	if err != nil {
+		return fmt.Errorf("conservation validation error: %v", err)
+	}
+	if violation != "" {
+		a.violate("conservation_violation", "alert_conservation_"+event.ID, "compliance", "high", event,
+			"Conservation limit violation", violation)
+	}
+	a.usage = usage
+
+	return nil
+}
+
+// applyReviewedCollectionEvent applies the ledger updates of a collection event held for review when a
+// supervisor verifies it. The quantity checks are run again, since events accepted in the meantime may
+// have used the harvest limit, quotas or permit; an event that no longer fits cannot be verified.
+func (c *HerbalTraceContract) applyReviewedCollectionEvent(ctx contractapi.TransactionContextInterface, event *CollectionEvent) error {
+	farmer, err := c.GetParticipant(ctx, event.FarmerID)
+	if err != nil {
+		return err
+	}
+	zone, err := c.GetApprovedZoneVersion(ctx, event.ApprovedZoneID, event.ApprovedZoneVersion)
+	if err != nil {
+		return err
+	}
+
+	a := &collectionAssessment{}
+	if err := c.assessHarvestQuantity(ctx, event, farmer, zone.Region, a); err != nil {
+		return err
+	}
+	if len(a.Violations) > 0 {
+		var messages []string
+		for _, violation := range a.Violations {
+			messages = append(messages, violation.Message)
+		}
+		return fmt.Errorf("collection event %s cannot be verified: %s", event.ID, strings.Join(messages, "; "))
+	}
+	if err := c.applyCollectionEvent(ctx, event, a); err != nil {
+		return err
+	}
+	for i, alertJSON := range a.alerts {
+		if err := c.CreateAlert(ctx, alertJSON); err != nil {
+			return fmt.Errorf("failed to raise alert %s: %v", a.AlertIDs[i], err)
+		}
+	}
+
+	return nil
+}
+
+// applyCollectionEvent applies the ledger updates of an accepted collection event: it tracks the
+// harvested quantity against the zone limit and the farmer and cooperative quotas, debits the
+// harvest permit and records the conservation usage
+func (c *HerbalTraceContract) applyCollectionEvent(ctx contractapi.TransactionContextInterface, event *CollectionEvent, a *collectionAssessment) error {
+	limit, previousStatus, err := c.trackHarvestLimit(ctx, event.Species, event.ZoneName, a.season, event.CanonicalQuantity, event.CanonicalUnit)
+	if err != nil {
+		return fmt.Errorf("failed to track harvest quantity: %v", err)
+	}
+	if err := c.trackHarvestQuotas(ctx, a.quotas, event.CanonicalQuantity, event.CanonicalUnit); err != nil {
+		return err
+	}
+	if a.permit != nil {
+		if err := c.putHarvestPermit(ctx, a.permit); err != nil {
+			return err
+		}
+	}
+	if a.usage != nil {
+		if err := putConservationUsage(ctx, a.usage); err != nil {
+			return err
+		}
+	}
+
+	// Warn once, when this event takes the limit past its warning threshold
+	if limit != nil && limit.Status == "warning" && previousStatus != "warning" {
+		percentageUsed := (limit.CurrentQuantity / limit.MaxQuantity) * 100
+		a.alert("alert_warning_"+event.ID, "over_harvest", "medium", event, "Harvest limit warning",
+			fmt.Sprintf("%.1f%% of harvest limit reached for %s in %s for season %s (%.2f / %.2f %s)",
+				percentageUsed, event.Species, event.ZoneName, a.season,
+				limit.CurrentQuantity, limit.MaxQuantity, limit.Unit))
+	}
+
+	return nil
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// allRegions is the region of a conservation status that applies wherever no regional status exists
+const allRegions = "*"
+
+// prohibitedCategories are the species registry categories whose harvest requires a harvest permit
+// when no conservation status is recorded for the species
+var prohibitedCategories = []string{"Endangered", "Critically Endangered"}
+
+// defaultProhibitedSpecies were prohibited before conservation status records existed. They stay
+// prohibited, whatever their registry category, until a conservation status is recorded for them.
+var defaultProhibitedSpecies = []string{"Aconitum heterophyllum", "Nardostachys jatamansi", "Picrorhiza kurroa"}
+
+// ConservationStatus records the conservation category of a species in a region and the harvest
+// caps that follow from it
+type ConservationStatus struct {
+	ID            string  `json:"id"`
+	Type          string  `json:"type"` // "ConservationStatus"
+	Species       string  `json:"species"`
+	Region        string  `json:"region"`   // Zone region, or "*" for every region
+	Category      string  `json:"category"` // IUCN/NMPB category, e.g. "Endangered"
+	Source        string  `json:"source"`   // e.g. "IUCN Red List 2024", "NMPB Notification 12/2023"
+	EffectiveDate string  `json:"effectiveDate"`
+	Prohibited    bool    `json:"prohibited"`              // Harvest of the species is not allowed
+	MaxPerHarvest float64 `json:"maxPerHarvest,omitempty"` // 0 = no cap
+	MaxPerSeason  float64 `json:"maxPerSeason,omitempty"`  // 0 = no cap
+	Unit          string  `json:"unit,omitempty"`
+	UpdatedBy     string  `json:"updatedBy"`
+	UpdatedAt     string  `json:"updatedAt"`
+}
+
+// ConservationUsage tracks the quantity harvested under a conservation status in one season
+type ConservationUsage struct {
+	ID       string  `json:"id"`
+	Type     string  `json:"type"` // "ConservationUsage"
+	StatusID string  `json:"statusId"`
+	Season   string  `json:"season"`
+	Quantity float64 `json:"quantity"`
+	Unit     string  `json:"unit"`
+}
+
+// conservationStatusKey returns the ledger key for the conservation status of a species in a region
+func conservationStatusKey(species string, region string) string {
+	return fmt.Sprintf("conservation_%s_%s", species, region)
+}
+
+// conservationUsageKey returns the ledger key for the seasonal usage of a conservation status
+func conservationUsageKey(statusID string, season string) string {
+	return fmt.Sprintf("conservationusage_%s_%s", statusID, season)
+}
+
+// SetConservationStatus creates or replaces the conservation status of a species in a region
+// (governed: applied through ExecuteProposal)
+func (c *HerbalTraceContract) SetConservationStatus(ctx contractapi.TransactionContextInterface, statusJSON string) error {
+	var status ConservationStatus
+	err := json.Unmarshal([]byte(statusJSON), &status)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal conservation status JSON: %v", err)
+	}
+
+	status.Species, err = c.normalizeSpecies(ctx, status.Species)
+	if err != nil {
+		return err
+	}
+	if status.Region == "" {
+		status.Region = allRegions
+	}
+	if status.Category == "" {
+		return fmt.Errorf("conservation category is required")
+	}
+	if status.Source == "" {
+		return fmt.Errorf("source is required")
+	}
+	if _, err := parseLedgerDate(status.EffectiveDate); err != nil {
+		return fmt.Errorf("invalid effective date: %v", err)
+	}
+	if status.MaxPerHarvest < 0 || status.MaxPerSeason < 0 {
+		return fmt.Errorf("harvest caps must not be negative")
+	}
+	if (status.MaxPerHarvest > 0 || status.MaxPerSeason > 0) && status.Unit == "" {
+		return fmt.Errorf("unit is required when harvest caps are set")
+	}
+	if status.Unit != "" {
+		if _, err := lookupUnit(status.Unit); err != nil {
+			return err
+		}
+	}
+
+	identity, err := getClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	status.ID = conservationStatusKey(status.Species, status.Region)
+	status.Type = "ConservationStatus"
+	status.UpdatedBy = identity.EnrollmentID
+	status.UpdatedAt = txTime.Format(time.RFC3339)
+
+	statusBytes, err := json.Marshal(status)
+	if err != nil {
+		return fmt.Errorf("failed to marshal conservation status: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(status.ID, statusBytes)
+	if err != nil {
+		return fmt.Errorf("failed to save conservation status to ledger: %v", err)
+	}
+
+	// Emit event
+	eventPayload := map[string]interface{}{
+		"eventType":     "ConservationStatusSet",
+		"species":       status.Species,
+		"region":        status.Region,
+		"category":      status.Category,
+		"prohibited":    status.Prohibited,
+		"effectiveDate": status.EffectiveDate,
+		"timestamp":     status.UpdatedAt,
+	}
+	eventBytes, _ := json.Marshal(eventPayload)
+	ctx.GetStub().SetEvent("ConservationStatusSet", eventBytes)
+
+	return nil
+}
+
+// RemoveConservationStatus deletes the conservation status of a species in a region
+// (governed: applied through ExecuteProposal)
+func (c *HerbalTraceContract) RemoveConservationStatus(ctx contractapi.TransactionContextInterface, statusID string) error {
+	existing, err := ctx.GetStub().GetState(statusID)
+	if err != nil {
+		return fmt.Errorf("failed to read conservation status: %v", err)
+	}
+	if existing == nil || !strings.HasPrefix(statusID, "conservation_") {
+		return fmt.Errorf("conservation status %s does not exist", statusID)
+	}
+
+	err = ctx.GetStub().DelState(statusID)
+	if err != nil {
+		return fmt.Errorf("failed to delete conservation status: %v", err)
+	}
+
+	return nil
+}
+
+// GetConservationStatus retrieves the conservation status that applies to a species in a region,
+// falling back to the status for every region
+func (c *HerbalTraceContract) GetConservationStatus(ctx contractapi.TransactionContextInterface, species string, region string) (*ConservationStatus, error) {
+	speciesID, err := c.normalizeSpecies(ctx, species)
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := c.findConservationStatus(ctx, speciesID, region)
+	if err != nil {
+		return nil, err
+	}
+	if status == nil {
+		return nil, fmt.Errorf("no conservation status recorded for species %s in region %s", speciesID, region)
+	}
+
+	return status, nil
+}
+
+// QueryConservationStatusBySpecies retrieves the conservation status of a species in every region
+func (c *HerbalTraceContract) QueryConservationStatusBySpecies(ctx contractapi.TransactionContextInterface, species string) ([]*ConservationStatus, error) {
+	speciesID, err := c.normalizeSpecies(ctx, species)
+	if err != nil {
+		return nil, err
+	}
+
+	queryString := fmt.Sprintf(`{"selector":{"type":"ConservationStatus","species":"%s"}}`, speciesID)
+	resultsIterator, err := ctx.GetStub().GetQueryResult(queryString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query conservation status: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	var statuses []*ConservationStatus
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var status ConservationStatus
+		err = json.Unmarshal(queryResponse.Value, &status)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, &status)
+	}
+
+	return statuses, nil
+}
+
+// findConservationStatus reads the regional conservation status of a species, then the status for
+// every region. It returns nil when neither exists.
+func (c *HerbalTraceContract) findConservationStatus(ctx contractapi.TransactionContextInterface, speciesID string, region string) (*ConservationStatus, error) {
+	for _, candidate := range []string{region, allRegions} {
+		if candidate == "" {
+			continue
+		}
+		statusBytes, err := ctx.GetStub().GetState(conservationStatusKey(speciesID, candidate))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read conservation status: %v", err)
+		}
+		if statusBytes == nil {
+			continue
+		}
+
+		var status ConservationStatus
+		err = json.Unmarshal(statusBytes, &status)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal conservation status: %v", err)
+		}
+		return &status, nil
+	}
+
+	return nil, nil
+}
+
+// validateConservationLimits evaluates the conservation status in force for the event's species and
+// region on the harvest date and fills the event's ConservationStatus. It returns the seasonal usage
+// including the event, for the caller to save once every other check has passed, or nil when no cap
+// applies, and a non-empty violation when the harvest breaches the status.
+// Without a recorded status the species registry's category applies and no caps are enforced; the
+// prohibited categories and the default prohibited species then require a harvest permit.
+// Prohibited species may only be harvested under a harvest permit, whose quantity replaces the caps.
+func (c *HerbalTraceContract) validateConservationLimits(ctx contractapi.TransactionContextInterface, event *CollectionEvent, region string, season string) (*ConservationUsage, string, error) {
+	status, err := c.findConservationStatus(ctx, event.Species, region)
+	if err != nil {
+		return nil, "", err
+	}
+	if status == nil {
+		if event.PermitID != "" {
+			return nil, "", nil
+		}
+		if containsString(prohibitedCategories, event.ConservationStatus) {
+			return nil, fmt.Sprintf("species %s is %s in the species registry and requires a harvest permit", event.Species, event.ConservationStatus), nil
+		}
+		for _, name := range defaultProhibitedSpecies {
+			if strings.EqualFold(name, event.ScientificName) {
+				return nil, fmt.Sprintf("species %s (%s) is endangered and requires a harvest permit", event.Species, event.ScientificName), nil
+			}
+		}
+		return nil, "", nil
+	}
+
+	harvestDate, err := parseLedgerDate(event.HarvestDate)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid harvest date: %v", err)
+	}
+	effectiveDate, err := parseLedgerDate(status.EffectiveDate)
+	if err != nil || harvestDate.Before(effectiveDate) {
+		return nil, "", nil
+	}
+	event.ConservationStatus = status.Category
+
+	if status.Prohibited {
+		if event.PermitID != "" {
+			return nil, "", nil
+		}
+		return nil, fmt.Sprintf("species %s is %s in region %s (%s) and requires a harvest permit", event.Species, status.Category, status.Region, status.Source), nil
+	}
+	if status.MaxPerHarvest == 0 && status.MaxPerSeason == 0 {
+		return nil, "", nil
+	}
+	quantity, err := convertQuantity(event.CanonicalQuantity, event.CanonicalUnit, status.Unit)
+	if err != nil {
+		return nil, fmt.Sprintf("conservation cap for species %s: %v", event.Species, err), nil
+	}
+	if status.MaxPerHarvest > 0 && quantity > status.MaxPerHarvest {
+		return nil, fmt.Sprintf("harvest of %.2f %s exceeds the per-harvest conservation cap of %.2f %s for species %s",
+			event.Quantity, event.Unit, status.MaxPerHarvest, status.Unit, event.Species), nil
+	}
+
+	usage := ConservationUsage{
+		ID:       conservationUsageKey(status.ID, season),
+		Type:     "ConservationUsage",
+		StatusID: status.ID,
+		Season:   season,
+		Unit:     status.Unit,
+	}
+	usageBytes, err := ctx.GetStub().GetState(usage.ID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read conservation usage: %v", err)
+	}
+	if usageBytes != nil {
+		if err := json.Unmarshal(usageBytes, &usage); err != nil {
+			return nil, "", fmt.Errorf("failed to unmarshal conservation usage: %v", err)
+		}
+	}
+	if status.MaxPerSeason > 0 && usage.Quantity+quantity > status.MaxPerSeason {
+		return nil, fmt.Sprintf("harvest of %.2f %s would exceed the seasonal conservation cap of %.2f %s for species %s (%.2f used in %s)",
+			event.Quantity, event.Unit, status.MaxPerSeason, status.Unit, event.Species, usage.Quantity, season), nil
+	}
+
+	usage.Quantity = roundQuantity(usage.Quantity + quantity)
+
+	return &usage, "", nil
+}
+
+// putConservationUsage writes the seasonal usage of a conservation status to the ledger
+func putConservationUsage(ctx contractapi.TransactionContextInterface, usage *ConservationUsage) error {
+	usageBytes, err := json.Marshal(usage)
+	if err != nil {
+		return fmt.Errorf("failed to marshal conservation usage: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(usage.ID, usageBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update conservation usage: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/statebased"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// setKeyEndorsement sets a key-level endorsement policy requiring peers of every listed
+// organization to endorse later updates of the key. Fabric enforces the policy at validation,
+// so clients updating the key must collect endorsements from all of these orgs. This includes
+// transactions that update the key as a side effect: an assigned batch needs the farmer cooperative
+// and the processor to endorse CreateQualityTest, CreateProcessingStep and CreateProduct as well.
+func setKeyEndorsement(ctx contractapi.TransactionContextInterface, key string, orgs ...string) error {
+	var mspIDs []string
+	for _, org := range orgs {
+		if org != "" && !containsString(mspIDs, org) {
+			mspIDs = append(mspIDs, org)
+		}
+	}
+	if len(mspIDs) == 0 {
+		return fmt.Errorf("at least one endorsing organization is required for key %s", key)
+	}
+
+	endorsementPolicy, err := statebased.NewStateEP(nil)
+	if err != nil {
+		return fmt.Errorf("failed to create endorsement policy: %v", err)
+	}
+	if err := endorsementPolicy.AddOrgs(statebased.RoleTypePeer, mspIDs...); err != nil {
+		return fmt.Errorf("failed to add endorsing orgs: %v", err)
+	}
+
+	policy, err := endorsementPolicy.Policy()
+	if err != nil {
+		return fmt.Errorf("failed to build endorsement policy: %v", err)
+	}
+
+	err = ctx.GetStub().SetStateValidationParameter(key, policy)
+	if err != nil {
+		return fmt.Errorf("failed to set endorsement policy for key %s: %v", key, err)
+	}
+
+	return nil
+}
+
+// GetEndorsementOrgs lists the organizations whose peers must endorse updates of a ledger key.
+// An empty list means the chaincode-level endorsement policy applies.
+func (c *HerbalTraceContract) GetEndorsementOrgs(ctx contractapi.TransactionContextInterface, key string) ([]string, error) {
+	if key == "" {
+		return nil, fmt.Errorf("key is required")
+	}
+
+	policy, err := ctx.GetStub().GetStateValidationParameter(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read endorsement policy for key %s: %v", key, err)
+	}
+	if len(policy) == 0 {
+		return []string{}, nil
+	}
+
+	endorsementPolicy, err := statebased.NewStateEP(policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse endorsement policy for key %s: %v", key, err)
+	}
+
+	return endorsementPolicy.ListOrgs(), nil
+}
+
+// batchFarmerOrg returns the organization of the farmer cooperative that created a batch
+func (c *HerbalTraceContract) batchFarmerOrg(ctx contractapi.TransactionContextInterface, batch *Batch) string {
+	if farmer, err := c.GetParticipant(ctx, batch.CreatedBy); err == nil {
+		return farmer.Organization
+	}
+	return batch.SubmitterMSP
+}
@@ -0,0 +1,468 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// personalDataCollections lists the private collections holding farmer personal data
+var personalDataCollections = []string{farmerPrivateCollection}
+
+// RetentionPolicy defines how long farmer personal data is kept in a private collection
+type RetentionPolicy struct {
+	ID            string `json:"id"`
+	Type          string `json:"type"` // "RetentionPolicy"
+	Collection    string `json:"collection"`
+	RetentionDays int    `json:"retentionDays"` // Days after the collection event before personal data is purged
+	LegalBasis    string `json:"legalBasis,omitempty"`
+	UpdatedBy     string `json:"updatedBy"`
+	UpdatedAt     string `json:"updatedAt"`
+}
+
+// ErasureRequest represents a farmer's request to erase their personal data
+type ErasureRequest struct {
+	ID             string   `json:"id"`
+	Type           string   `json:"type"` // "ErasureRequest"
+	FarmerID       string   `json:"farmerId"`
+	Reason         string   `json:"reason,omitempty"`
+	Status         string   `json:"status"` // "pending", "completed", "rejected"
+	RequestedBy    string   `json:"requestedBy"`
+	RequestedAt    string   `json:"requestedAt"`
+	DecidedBy      string   `json:"decidedBy,omitempty"`
+	DecidedAt      string   `json:"decidedAt,omitempty"`
+	DecisionReason string   `json:"decisionReason,omitempty"` // Legal ground when a request is rejected
+	ErasedEventIDs []string `json:"erasedEventIds,omitempty"`
+}
+
+// ErasureLog is the audit record of one purge of personal data
+type ErasureLog struct {
+	ID         string   `json:"id"`
+	Type       string   `json:"type"`    // "ErasureLog"
+	Trigger    string   `json:"trigger"` // "request", "retention"
+	RequestID  string   `json:"requestId,omitempty"`
+	FarmerID   string   `json:"farmerId,omitempty"`
+	Collection string   `json:"collection"`
+	EventIDs   []string `json:"eventIds"`
+	ErasedBy   string   `json:"erasedBy"`
+	ErasedAt   string   `json:"erasedAt"`
+	TxID       string   `json:"txId"`
+}
+
+// retentionPolicyKey returns the ledger key for the retention policy of a collection
+func retentionPolicyKey(collection string) string {
+	return "retention_" + collection
+}
+
+// erasureRequestKey returns the ledger key for an erasure request ID
+func erasureRequestKey(requestID string) string {
+	return "erasure_" + requestID
+}
+
+// SetRetentionPolicy sets the retention period of a personal data collection
+// (governed: applied through ExecuteProposal)
+func (c *HerbalTraceContract) SetRetentionPolicy(ctx contractapi.TransactionContextInterface, policyJSON string) error {
+	var policy RetentionPolicy
+	err := json.Unmarshal([]byte(policyJSON), &policy)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal retention policy JSON: %v", err)
+	}
+
+	if !containsString(personalDataCollections, policy.Collection) {
+		return fmt.Errorf("collection %s does not hold personal data", policy.Collection)
+	}
+	if policy.RetentionDays <= 0 {
+		return fmt.Errorf("retention days must be greater than zero")
+	}
+
+	identity, err := getClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	policy.ID = retentionPolicyKey(policy.Collection)
+	policy.Type = "RetentionPolicy"
+	policy.UpdatedBy = identity.EnrollmentID
+	policy.UpdatedAt = txTime.Format(time.RFC3339)
+
+	policyBytes, err := json.Marshal(policy)
+	if err != nil {
+		return fmt.Errorf("failed to marshal retention policy: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(policy.ID, policyBytes)
+	if err != nil {
+		return fmt.Errorf("failed to put retention policy: %v", err)
+	}
+
+	return nil
+}
+
+// GetRetentionPolicy retrieves the retention policy of a personal data collection
+func (c *HerbalTraceContract) GetRetentionPolicy(ctx contractapi.TransactionContextInterface, collection string) (*RetentionPolicy, error) {
+	policyBytes, err := ctx.GetStub().GetState(retentionPolicyKey(collection))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read retention policy: %v", err)
+	}
+	if policyBytes == nil {
+		return nil, fmt.Errorf("no retention policy defined for collection %s", collection)
+	}
+
+	var policy RetentionPolicy
+	err = json.Unmarshal(policyBytes, &policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal retention policy: %v", err)
+	}
+
+	return &policy, nil
+}
+
+// ApplyRetentionPolicy purges the personal data of every collection event older than the
+// collection's retention period and returns the IDs of the purged events
+func (c *HerbalTraceContract) ApplyRetentionPolicy(ctx contractapi.TransactionContextInterface, collection string) ([]string, error) {
+	policy, err := c.GetRetentionPolicy(ctx, collection)
+	if err != nil {
+		return nil, err
+	}
+
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cutoff := txTime.AddDate(0, 0, -policy.RetentionDays)
+
+	queryString := `{"selector":{"type":"CollectionEvent","privateDataHash":{"$gt":""},"privateDataErasedAt":{"$exists":false}}}`
+	events, err := c.queryCollectionEvents(ctx, queryString)
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []*CollectionEvent
+	for _, event := range events {
+		recordedAt, err := time.Parse(time.RFC3339, event.Timestamp)
+		if err != nil || !recordedAt.Before(cutoff) {
+			continue
+		}
+		expired = append(expired, event)
+	}
+
+	erasureLog, err := c.erasePersonalData(ctx, collection, expired, "retention", "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	return erasureLog.EventIDs, nil
+}
+
+// RequestDataErasure records a farmer's request to erase their personal data.
+// Farmers may only request erasure of their own data; admins may file requests on their behalf.
+func (c *HerbalTraceContract) RequestDataErasure(ctx contractapi.TransactionContextInterface, requestJSON string) error {
+	var request ErasureRequest
+	err := json.Unmarshal([]byte(requestJSON), &request)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal erasure request JSON: %v", err)
+	}
+
+	if request.ID == "" {
+		return fmt.Errorf("erasure request ID is required")
+	}
+
+	identity, farmerID, err := resolveActor(ctx, request.FarmerID, true)
+	if err != nil {
+		return err
+	}
+
+	exists, err := ctx.GetStub().GetState(erasureRequestKey(request.ID))
+	if err != nil {
+		return fmt.Errorf("failed to check if erasure request exists: %v", err)
+	}
+	if exists != nil {
+		return fmt.Errorf("erasure request %s already exists", request.ID)
+	}
+
+	request.Type = "ErasureRequest"
+	request.FarmerID = farmerID
+	request.Status = "pending"
+	request.RequestedBy = identity.EnrollmentID
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+	request.RequestedAt = txTime.Format(time.RFC3339)
+	request.DecidedBy = ""
+	request.DecidedAt = ""
+	request.DecisionReason = ""
+	request.ErasedEventIDs = nil
+
+	if err := c.putErasureRequest(ctx, &request); err != nil {
+		return err
+	}
+
+	// Emit event
+	eventPayload := map[string]interface{}{
+		"eventType": "DataErasureRequested",
+		"requestId": request.ID,
+		"farmerId":  request.FarmerID,
+		"timestamp": request.RequestedAt,
+	}
+	eventBytes, _ := json.Marshal(eventPayload)
+	ctx.GetStub().SetEvent("DataErasureRequested", eventBytes)
+
+	return nil
+}
+
+// ExecuteDataErasure purges the private details of every collection event of the requesting farmer.
+// Public events keep their salted hashes so that the traceability record stays verifiable.
+func (c *HerbalTraceContract) ExecuteDataErasure(ctx contractapi.TransactionContextInterface, requestID string) error {
+	request, err := c.GetErasureRequest(ctx, requestID)
+	if err != nil {
+		return err
+	}
+	if request.Status != "pending" {
+		return fmt.Errorf("erasure request %s is %s", requestID, request.Status)
+	}
+
+	queryString := fmt.Sprintf(`{"selector":{"type":"CollectionEvent","farmerId":"%s","privateDataErasedAt":{"$exists":false}}}`, request.FarmerID)
+	events, err := c.queryCollectionEvents(ctx, queryString)
+	if err != nil {
+		return err
+	}
+
+	erasureLog, err := c.erasePersonalData(ctx, farmerPrivateCollection, events, "request", request.ID, request.FarmerID)
+	if err != nil {
+		return err
+	}
+
+	request.Status = "completed"
+	request.DecidedBy = erasureLog.ErasedBy
+	request.DecidedAt = erasureLog.ErasedAt
+	request.ErasedEventIDs = erasureLog.EventIDs
+
+	return c.putErasureRequest(ctx, request)
+}
+
+// RejectDataErasure rejects an erasure request, e.g. when the data must be retained by law
+func (c *HerbalTraceContract) RejectDataErasure(ctx contractapi.TransactionContextInterface, requestID string, reason string) error {
+	if reason == "" {
+		return fmt.Errorf("a reason is required to reject an erasure request")
+	}
+
+	request, err := c.GetErasureRequest(ctx, requestID)
+	if err != nil {
+		return err
+	}
+	if request.Status != "pending" {
+		return fmt.Errorf("erasure request %s is %s", requestID, request.Status)
+	}
+
+	identity, err := getClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	request.Status = "rejected"
+	request.DecidedBy = identity.EnrollmentID
+	request.DecidedAt = txTime.Format(time.RFC3339)
+	request.DecisionReason = reason
+
+	if err := c.putErasureRequest(ctx, request); err != nil {
+		return err
+	}
+
+	// Emit event
+	eventPayload := map[string]interface{}{
+		"eventType":  "DataErasureRejected",
+		"requestId":  request.ID,
+		"farmerId":   request.FarmerID,
+		"rejectedBy": request.DecidedBy,
+		"reason":     reason,
+		"timestamp":  request.DecidedAt,
+	}
+	eventBytes, _ := json.Marshal(eventPayload)
+	ctx.GetStub().SetEvent("DataErasureRejected", eventBytes)
+
+	return nil
+}
+
+// GetErasureRequest retrieves an erasure request. Farmers may only read their own requests.
+func (c *HerbalTraceContract) GetErasureRequest(ctx contractapi.TransactionContextInterface, requestID string) (*ErasureRequest, error) {
+	requestBytes, err := ctx.GetStub().GetState(erasureRequestKey(requestID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read erasure request: %v", err)
+	}
+	if requestBytes == nil {
+		return nil, fmt.Errorf("erasure request %s does not exist", requestID)
+	}
+
+	var request ErasureRequest
+	err = json.Unmarshal(requestBytes, &request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal erasure request: %v", err)
+	}
+
+	identity, err := getClientIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if identity.Role == RoleFarmer && identity.EnrollmentID != request.FarmerID {
+		return nil, fmt.Errorf("access denied: farmer %s may not read erasure request %s", identity.EnrollmentID, requestID)
+	}
+
+	return &request, nil
+}
+
+// QueryErasureLogs retrieves the audit trail of personal data erasures, optionally for a single farmer.
+// Farmers may only query their own erasures.
+func (c *HerbalTraceContract) QueryErasureLogs(ctx contractapi.TransactionContextInterface, farmerID string) ([]*ErasureLog, error) {
+	identity, err := getClientIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if identity.Role == RoleFarmer && identity.EnrollmentID != farmerID {
+		return nil, fmt.Errorf("access denied: farmer %s may only query their own erasure logs", identity.EnrollmentID)
+	}
+
+	queryString := `{"selector":{"type":"ErasureLog"}}`
+	if farmerID != "" {
+		queryString = fmt.Sprintf(`{"selector":{"type":"ErasureLog","farmerId":"%s"}}`, farmerID)
+	}
+
+	resultsIterator, err := ctx.GetStub().GetQueryResult(queryString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query erasure logs: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	var logs []*ErasureLog
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var erasureLog ErasureLog
+		err = json.Unmarshal(queryResponse.Value, &erasureLog)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, &erasureLog)
+	}
+
+	return logs, nil
+}
+
+// erasePersonalData purges the private details of the given collection events, marks the public
+// events as erased and writes an ErasureLog audit record
+func (c *HerbalTraceContract) erasePersonalData(ctx contractapi.TransactionContextInterface, collection string, events []*CollectionEvent, trigger string, requestID string, farmerID string) (*ErasureLog, error) {
+	identity, err := getClientIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	txID := ctx.GetStub().GetTxID()
+	erasureLog := ErasureLog{
+		ID:         "erasurelog_" + txID,
+		Type:       "ErasureLog",
+		Trigger:    trigger,
+		RequestID:  requestID,
+		FarmerID:   farmerID,
+		Collection: collection,
+		EventIDs:   []string{},
+		ErasedBy:   identity.EnrollmentID,
+		ErasedAt:   txTime.Format(time.RFC3339),
+		TxID:       txID,
+	}
+
+	for _, event := range events {
+		// Purging removes the private data and its history from member peers; the hash stays on the ledger
+		err = ctx.GetStub().PurgePrivateData(collection, event.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to purge private data of event %s: %v", event.ID, err)
+		}
+
+		event.PrivateDataErasedAt = erasureLog.ErasedAt
+		eventBytes, err := json.Marshal(event)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal collection event: %v", err)
+		}
+		err = ctx.GetStub().PutState(event.ID, eventBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update collection event %s: %v", event.ID, err)
+		}
+
+		erasureLog.EventIDs = append(erasureLog.EventIDs, event.ID)
+	}
+
+	// Drop the erased events' GPS fixes from their farmers' location histories
+	if collection == farmerPrivateCollection {
+		eventIDsByFarmer := map[string][]string{}
+		var farmerIDs []string
+		for _, event := range events {
+			if _, seen := eventIDsByFarmer[event.FarmerID]; !seen {
+				farmerIDs = append(farmerIDs, event.FarmerID)
+			}
+			eventIDsByFarmer[event.FarmerID] = append(eventIDsByFarmer[event.FarmerID], event.ID)
+		}
+		for _, id := range farmerIDs {
+			if err := removeLocationFixes(ctx, id, eventIDsByFarmer[id]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	logBytes, err := json.Marshal(erasureLog)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal erasure log: %v", err)
+	}
+	err = ctx.GetStub().PutState(erasureLog.ID, logBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to put erasure log: %v", err)
+	}
+
+	// Emit event
+	eventPayload := map[string]interface{}{
+		"eventType":  "PersonalDataErased",
+		"logId":      erasureLog.ID,
+		"trigger":    trigger,
+		"requestId":  requestID,
+		"farmerId":   farmerID,
+		"collection": collection,
+		"eventCount": len(erasureLog.EventIDs),
+		"erasedBy":   erasureLog.ErasedBy,
+		"timestamp":  erasureLog.ErasedAt,
+	}
+	eventBytes, _ := json.Marshal(eventPayload)
+	ctx.GetStub().SetEvent("PersonalDataErased", eventBytes)
+
+	return &erasureLog, nil
+}
+
+// putErasureRequest writes an erasure request to the ledger
+func (c *HerbalTraceContract) putErasureRequest(ctx contractapi.TransactionContextInterface, request *ErasureRequest) error {
+	requestBytes, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal erasure request: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(erasureRequestKey(request.ID), requestBytes)
+	if err != nil {
+		return fmt.Errorf("failed to put erasure request: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// fraudPolicyKey is the ledger key of the fraud detection policy
+const fraudPolicyKey = "fraudpolicy"
+
+// FraudPolicy configures the checks that hold implausible collector activity for review
+type FraudPolicy struct {
+	ID                      string  `json:"id"`
+	Type                    string  `json:"type"`                    // "FraudPolicy"
+	MaxTravelSpeedKmh       float64 `json:"maxTravelSpeedKmh"`       // Fastest plausible travel between two collection sites
+	MinTravelDistanceMeters float64 `json:"minTravelDistanceMeters"` // Shorter moves are GPS jitter and never count as travel
+	MaxEventsPerDay         int     `json:"maxEventsPerDay"`         // Collection events one farmer may record per harvest date
+	DuplicateWindowMinutes  int     `json:"duplicateWindowMinutes"`  // Same species and quantity captured this close together is a duplicate
+	UpdatedBy               string  `json:"updatedBy"`
+	UpdatedAt               string  `json:"updatedAt"`
+}
+
+// defaultFraudPolicy applies until a fraud policy is set
+var defaultFraudPolicy = FraudPolicy{
+	ID:                      fraudPolicyKey,
+	Type:                    "FraudPolicy",
+	MaxTravelSpeedKmh:       120,
+	MinTravelDistanceMeters: 1000,
+	MaxEventsPerDay:         12,
+	DuplicateWindowMinutes:  15,
+}
+
+// FarmerDailyActivity lists the collection events a farmer recorded for one harvest date
+type FarmerDailyActivity struct {
+	ID       string          `json:"id"`
+	Type     string          `json:"type"` // "FarmerDailyActivity"
+	FarmerID string          `json:"farmerId"`
+	Date     string          `json:"date"` // Harvest date, YYYY-MM-DD
+	Events   []DailyActivity `json:"events"`
+}
+
+// DailyActivity is one collection event of a farmer's day
+type DailyActivity struct {
+	EventID           string  `json:"eventId"`
+	Species           string  `json:"species"`
+	CanonicalQuantity float64 `json:"canonicalQuantity"`
+	CanonicalUnit     string  `json:"canonicalUnit"`
+	CapturedAt        string  `json:"capturedAt"`
+}
+
+// activityAnomaly is a reason to hold a collection event for review
+type activityAnomaly struct {
+	Code    string // Alert ID prefix, e.g. "travel"
+	Message string
+	Details string
+}
+
+// dailyActivityKey returns the ledger key of a farmer's activity on a harvest date
+func dailyActivityKey(farmerID string, date string) string {
+	return fmt.Sprintf("dailyactivity_%s_%s", farmerID, date)
+}
+
+// SetFraudPolicy replaces the fraud detection policy
+func (c *HerbalTraceContract) SetFraudPolicy(ctx contractapi.TransactionContextInterface, policyJSON string) error {
+	var policy FraudPolicy
+	err := json.Unmarshal([]byte(policyJSON), &policy)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal fraud policy JSON: %v", err)
+	}
+
+	if policy.MaxTravelSpeedKmh <= 0 {
+		return fmt.Errorf("max travel speed must be greater than zero")
+	}
+	if policy.MinTravelDistanceMeters < 0 {
+		return fmt.Errorf("min travel distance must not be negative")
+	}
+	if policy.MaxEventsPerDay < 1 {
+		return fmt.Errorf("max events per day must be at least 1")
+	}
+	if policy.DuplicateWindowMinutes < 0 {
+		return fmt.Errorf("duplicate window must not be negative")
+	}
+
+	identity, err := getClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	policy.ID = fraudPolicyKey
+	policy.Type = "FraudPolicy"
+	policy.UpdatedBy = identity.EnrollmentID
+	policy.UpdatedAt = txTime.Format(time.RFC3339)
+
+	policyBytes, err := json.Marshal(policy)
+	if err != nil {
+		return fmt.Errorf("failed to marshal fraud policy: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(policy.ID, policyBytes)
+	if err != nil {
+		return fmt.Errorf("failed to save fraud policy to ledger: %v", err)
+	}
+
+	return nil
+}
+
+// GetFraudPolicy retrieves the fraud detection policy, falling back to the default policy
+func (c *HerbalTraceContract) GetFraudPolicy(ctx contractapi.TransactionContextInterface) (*FraudPolicy, error) {
+	policyBytes, err := ctx.GetStub().GetState(fraudPolicyKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fraud policy: %v", err)
+	}
+	if policyBytes == nil {
+		policy := defaultFraudPolicy
+		return &policy, nil
+	}
+
+	var policy FraudPolicy
+	err = json.Unmarshal(policyBytes, &policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal fraud policy: %v", err)
+	}
+
+	return &policy, nil
+}
+
+// GetFarmerDailyActivity retrieves the collection events a farmer recorded for a harvest date (YYYY-MM-DD)
+func (c *HerbalTraceContract) GetFarmerDailyActivity(ctx contractapi.TransactionContextInterface, farmerID string, date string) (*FarmerDailyActivity, error) {
+	identity, err := getClientIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if identity.Role == RoleFarmer && identity.EnrollmentID != farmerID {
+		return nil, fmt.Errorf("access denied: farmer %s may only query their own activity", identity.EnrollmentID)
+	}
+
+	return getDailyActivity(ctx, farmerID, date)
+}
+
+// checkCollectorActivity compares a collection event with the farmer's recent events. It reports
+// travel between collection sites faster than the fraud policy allows (by haversine distance to the
+// exact coordinates in the farmer's private location history, over the capture time difference), more
+// events or a larger quantity of the species in a day than is plausible, and near-identical events
+// captured close together.
+func (c *HerbalTraceContract) checkCollectorActivity(ctx contractapi.TransactionContextInterface, event *CollectionEvent, species *Species) ([]activityAnomaly, error) {
+	policy, err := c.GetFraudPolicy(ctx)
+	if err != nil {
+		return nil, err
+	}
+	capturedAt, err := time.Parse(time.RFC3339, event.CapturedAt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid capture time format: %v", err)
+	}
+
+	var anomalies []activityAnomaly
+
+	// Impossible travel: the fastest implied speed to any recent collection site
+	history, err := getLocationHistory(ctx, event.FarmerID)
+	if err != nil {
+		return nil, err
+	}
+	var fastest *LocationFix
+	fastestSpeed, fastestDistance := 0.0, 0.0
+	for i, fix := range history.Fixes {
+		distance := haversineMeters(fix.Latitude, fix.Longitude, event.Latitude, event.Longitude)
+		if distance <= policy.MinTravelDistanceMeters {
+			continue
+		}
+		fixCapturedAt, err := time.Parse(time.RFC3339, fix.CapturedAt)
+		if err != nil {
+			continue
+		}
+		hours := math.Abs(capturedAt.Sub(fixCapturedAt).Hours())
+		speed := math.Inf(1)
+		if hours > 0 {
+			speed = distance / 1000 / hours
+		}
+		if speed > policy.MaxTravelSpeedKmh && speed > fastestSpeed {
+			fastest, fastestSpeed, fastestDistance = &history.Fixes[i], speed, distance
+		}
+	}
+	if fastest != nil {
+		anomalies = append(anomalies, activityAnomaly{
+			Code:    "travel",
+			Message: "Impossible travel between collection sites",
+			Details: fmt.Sprintf("Event %s was captured %.1f km from event %s (captured %s at %s), implying %.0f km/h; the limit is %.0f km/h",
+				event.ID, fastestDistance/1000, fastest.EventID, fastest.CapturedAt, event.CapturedAt, fastestSpeed, policy.MaxTravelSpeedKmh),
+		})
+	}
+
+	// Velocity: events per day, quantity of the species per day and near-identical events
+	harvestDate, err := parseLedgerDate(event.HarvestDate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid harvest date: %v", err)
+	}
+	activity, err := getDailyActivity(ctx, event.FarmerID, harvestDate.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	if len(activity.Events)+1 > policy.MaxEventsPerDay {
+		anomalies = append(anomalies, activityAnomaly{
+			Code:    "velocity",
+			Message: "Too many collection events in a day",
+			Details: fmt.Sprintf("Farmer %s has recorded %d collection events for %s; event %s exceeds the limit of %d",
+				event.FarmerID, len(activity.Events), activity.Date, event.ID, policy.MaxEventsPerDay),
+		})
+	}
+
+	dailyQuantity := event.CanonicalQuantity
+	duplicateOf := ""
+	for _, entry := range activity.Events {
+		if entry.Species != event.Species || entry.CanonicalUnit != event.CanonicalUnit {
+			continue
+		}
+		dailyQuantity += entry.CanonicalQuantity
+
+		entryCapturedAt, err := time.Parse(time.RFC3339, entry.CapturedAt)
+		if err != nil {
+			continue
+		}
+		if duplicateOf == "" && math.Abs(entry.CanonicalQuantity-event.CanonicalQuantity) <= quantityTolerance &&
+			math.Abs(capturedAt.Sub(entryCapturedAt).Minutes()) <= float64(policy.DuplicateWindowMinutes) {
+			duplicateOf = entry.EventID
+		}
+	}
+	if duplicateOf != "" {
+		anomalies = append(anomalies, activityAnomaly{
+			Code:    "duplicate",
+			Message: "Near-identical collection events",
+			Details: fmt.Sprintf("Event %s records the same species and quantity as event %s captured within %d minutes",
+				event.ID, duplicateOf, policy.DuplicateWindowMinutes),
+		})
+	}
+	if species.MaxDailyQuantity > 0 {
+		ceiling, err := convertQuantity(species.MaxDailyQuantity, species.DailyQuantityUnit, event.CanonicalUnit)
+		if err == nil && dailyQuantity > ceiling {
+			anomalies = append(anomalies, activityAnomaly{
+				Code:    "velocity_quantity",
+				Message: "Daily harvest quantity implausible",
+				Details: fmt.Sprintf("Farmer %s would have harvested %.2f %s of %s on %s; the daily ceiling is %.2f %s",
+					event.FarmerID, dailyQuantity, event.CanonicalUnit, event.Species, activity.Date,
+					species.MaxDailyQuantity, species.DailyQuantityUnit),
+			})
+		}
+	}
+
+	return anomalies, nil
+}
+
+// recordDailyActivity adds a collection event to the farmer's activity for its harvest date
+func recordDailyActivity(ctx contractapi.TransactionContextInterface, event *CollectionEvent) error {
+	harvestDate, err := parseLedgerDate(event.HarvestDate)
+	if err != nil {
+		return fmt.Errorf("invalid harvest date: %v", err)
+	}
+	activity, err := getDailyActivity(ctx, event.FarmerID, harvestDate.Format("2006-01-02"))
+	if err != nil {
+		return err
+	}
+
+	activity.Events = append(activity.Events, DailyActivity{
+		EventID:           event.ID,
+		Species:           event.Species,
+		CanonicalQuantity: event.CanonicalQuantity,
+		CanonicalUnit:     event.CanonicalUnit,
+		CapturedAt:        event.CapturedAt,
+	})
+
+	activityBytes, err := json.Marshal(activity)
+	if err != nil {
+		return fmt.Errorf("failed to marshal daily activity: %v", err)
+	}
+	err = ctx.GetStub().PutState(activity.ID, activityBytes)
+	if err != nil {
+		return fmt.Errorf("failed to save daily activity: %v", err)
+	}
+
+	return nil
+}
+
+// getDailyActivity reads a farmer's activity on a harvest date, which is empty when none was recorded
+func getDailyActivity(ctx contractapi.TransactionContextInterface, farmerID string, date string) (*FarmerDailyActivity, error) {
+	activity := FarmerDailyActivity{
+		ID:       dailyActivityKey(farmerID, date),
+		Type:     "FarmerDailyActivity",
+		FarmerID: farmerID,
+		Date:     date,
+		Events:   []DailyActivity{},
+	}
+
+	activityBytes, err := ctx.GetStub().GetState(activity.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read daily activity: %v", err)
+	}
+	if activityBytes != nil {
+		err = json.Unmarshal(activityBytes, &activity)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal daily activity: %v", err)
+		}
+	}
+
+	return &activity, nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// earthRadiusMeters is the mean Earth radius used for distance calculations
+const earthRadiusMeters = 6371008.8
+
+// GeoJSONGeometry is a GeoJSON Polygon or MultiPolygon geometry.
+// Positions are [longitude, latitude] as required by RFC 7946.
+type GeoJSONGeometry struct {
+	Type        string          `json:"type"` // "Polygon", "MultiPolygon"
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+// geoPolygon is a polygon as an outer ring followed by optional holes; each point is [lon, lat]
+type geoPolygon [][][2]float64
+
+// polygons decodes the geometry into its polygons and validates their rings
+func (g GeoJSONGeometry) polygons() ([]geoPolygon, error) {
+	var polygons []geoPolygon
+	switch g.Type {
+	case "Polygon":
+		var polygon geoPolygon
+		if err := json.Unmarshal(g.Coordinates, &polygon); err != nil {
+			return nil, fmt.Errorf("invalid Polygon coordinates: %v", err)
+		}
+		polygons = []geoPolygon{polygon}
+	case "MultiPolygon":
+		if err := json.Unmarshal(g.Coordinates, &polygons); err != nil {
+			return nil, fmt.Errorf("invalid MultiPolygon coordinates: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("geometry type must be Polygon or MultiPolygon, got %q", g.Type)
+	}
+
+	if len(polygons) == 0 {
+		return nil, fmt.Errorf("geometry has no polygons")
+	}
+	for i, polygon := range polygons {
+		if len(polygon) == 0 {
+			return nil, fmt.Errorf("polygon %d has no rings", i)
+		}
+		for j, ring := range polygon {
+			if len(ring) < 4 {
+				return nil, fmt.Errorf("ring %d of polygon %d must have at least 4 positions", j, i)
+			}
+			if ring[0] != ring[len(ring)-1] {
+				return nil, fmt.Errorf("ring %d of polygon %d is not closed", j, i)
+			}
+			for _, point := range ring {
+				if point[0] < -180 || point[0] > 180 || point[1] < -90 || point[1] > 90 {
+					return nil, fmt.Errorf("position [%f, %f] of polygon %d is out of range", point[0], point[1], i)
+				}
+			}
+		}
+	}
+
+	return polygons, nil
+}
+
+// containsPoint reports whether the point lies inside the polygon's outer ring and outside its holes
+func (p geoPolygon) containsPoint(lat, lon float64) bool {
+	if !ringContainsPoint(p[0], lat, lon) {
+		return false
+	}
+	for _, hole := range p[1:] {
+		if ringContainsPoint(hole, lat, lon) {
+			return false
+		}
+	}
+	return true
+}
+
+// distanceToBoundary returns the distance in meters from the point to the nearest edge of the polygon
+func (p geoPolygon) distanceToBoundary(lat, lon float64) float64 {
+	minDistance := math.Inf(1)
+	for _, ring := range p {
+		for i := 0; i < len(ring)-1; i++ {
+			distance := segmentDistanceMeters(lat, lon, ring[i], ring[i+1])
+			if distance < minDistance {
+				minDistance = distance
+			}
+		}
+	}
+	return minDistance
+}
+
+// ringContainsPoint applies the even-odd ray casting rule to a closed ring
+func ringContainsPoint(ring [][2]float64, lat, lon float64) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		xi, yi := ring[i][0], ring[i][1]
+		xj, yj := ring[j][0], ring[j][1]
+		if (yi > lat) != (yj > lat) && lon < (xj-xi)*(lat-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// segmentDistanceMeters returns the distance in meters from a point to a segment, using an
+// equirectangular projection centred on the point (accurate at zone scale)
+func segmentDistanceMeters(lat, lon float64, a, b [2]float64) float64 {
+	metersPerDegree := earthRadiusMeters * math.Pi / 180
+	cosLat := math.Cos(lat * math.Pi / 180)
+
+	ax, ay := (a[0]-lon)*cosLat*metersPerDegree, (a[1]-lat)*metersPerDegree
+	bx, by := (b[0]-lon)*cosLat*metersPerDegree, (b[1]-lat)*metersPerDegree
+
+	dx, dy := bx-ax, by-ay
+	t := 0.0
+	if lengthSquared := dx*dx + dy*dy; lengthSquared > 0 {
+		t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/lengthSquared))
+	}
+	return math.Hypot(ax+t*dx, ay+t*dy)
+}
+
+// haversineMeters returns the great-circle distance in meters between two points
+func haversineMeters(lat1, lon1, lat2, lon2 float64) float64 {
+	phi1, phi2 := lat1*math.Pi/180, lat2*math.Pi/180
+	dPhi := (lat2 - lat1) * math.Pi / 180
+	dLambda := (lon2 - lon1) * math.Pi / 180
+
+	a := math.Sin(dPhi/2)*math.Sin(dPhi/2) + math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Sqrt(math.Min(1, a)))
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+// squareWithHole is a 1 degree square around (30.5 N, 78.5 E) with a 0.2 degree hole in the middle
+var squareWithHole = geoPolygon{
+	{{78, 30}, {79, 30}, {79, 31}, {78, 31}, {78, 30}},
+	{{78.4, 30.4}, {78.6, 30.4}, {78.6, 30.6}, {78.4, 30.6}, {78.4, 30.4}},
+}
+
+func TestGeoPolygonContainsPoint(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lon float64
+		want     bool
+	}{
+		{"inside outer ring", 30.2, 78.2, true},
+		{"inside hole", 30.5, 78.5, false},
+		{"between hole and edge", 30.5, 78.8, true},
+		{"north of polygon", 31.5, 78.5, false},
+		{"west of polygon", 30.5, 77.5, false},
+		{"east of polygon on the ray", 30.5, 79.5, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := squareWithHole.containsPoint(tt.lat, tt.lon); got != tt.want {
+				t.Errorf("containsPoint(%v, %v) = %v, want %v", tt.lat, tt.lon, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRingContainsPointConcave(t *testing.T) {
+	// U shape opening north: the notch between the arms is outside
+	ring := [][2]float64{{0, 0}, {3, 0}, {3, 3}, {2, 3}, {2, 1}, {1, 1}, {1, 3}, {0, 3}, {0, 0}}
+	tests := []struct {
+		name     string
+		lat, lon float64
+		want     bool
+	}{
+		{"base", 0.5, 1.5, true},
+		{"left arm", 2, 0.5, true},
+		{"right arm", 2, 2.5, true},
+		{"notch", 2, 1.5, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ringContainsPoint(ring, tt.lat, tt.lon); got != tt.want {
+				t.Errorf("ringContainsPoint(%v, %v) = %v, want %v", tt.lat, tt.lon, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGeoPolygonDistanceToBoundary(t *testing.T) {
+	metersPerDegree := earthRadiusMeters * math.Pi / 180
+	tests := []struct {
+		name     string
+		lat, lon float64
+		want     float64
+	}{
+		{"on southern edge", 30, 78.2, 0},
+		{"0.1 degree north of southern edge", 30.1, 78.2, 0.1 * metersPerDegree},
+		{"0.1 degree south of polygon", 29.9, 78.2, 0.1 * metersPerDegree},
+		{"nearest edge is the hole", 30.5, 78.65, 0.05 * math.Cos(30.5*math.Pi/180) * metersPerDegree},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := squareWithHole.distanceToBoundary(tt.lat, tt.lon)
+			if math.Abs(got-tt.want) > 1 {
+				t.Errorf("distanceToBoundary(%v, %v) = %.1f m, want %.1f m", tt.lat, tt.lon, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHaversineMeters(t *testing.T) {
+	tests := []struct {
+		name                   string
+		lat1, lon1, lat2, lon2 float64
+		want                   float64
+		tolerance              float64
+	}{
+		{"same point", 30.3165, 78.0322, 30.3165, 78.0322, 0, 0.001},
+		{"one degree of latitude", 30, 78, 31, 78, earthRadiusMeters * math.Pi / 180, 0.001},
+		{"quarter of the equator", 0, 0, 0, 90, earthRadiusMeters * math.Pi / 2, 0.001},
+		{"antipodes", 0, 0, 0, 180, earthRadiusMeters * math.Pi, 0.001},
+		{"Dehradun to Rishikesh", 30.3165, 78.0322, 30.0869, 78.2676, 34200, 500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := haversineMeters(tt.lat1, tt.lon1, tt.lat2, tt.lon2)
+			if math.Abs(got-tt.want) > tt.tolerance {
+				t.Errorf("haversineMeters = %.3f m, want %.3f m", got, tt.want)
+			}
+			if reverse := haversineMeters(tt.lat2, tt.lon2, tt.lat1, tt.lon1); math.Abs(reverse-got) > 0.001 {
+				t.Errorf("haversineMeters is not symmetric: %.3f m and %.3f m", got, reverse)
+			}
+		})
+	}
+}
+
+func TestGeoJSONGeometryPolygons(t *testing.T) {
+	tests := []struct {
+		name      string
+		geometry  GeoJSONGeometry
+		wantCount int
+		wantErr   bool
+	}{
+		{"polygon", GeoJSONGeometry{"Polygon", json.RawMessage(`[[[78,30],[79,30],[79,31],[78,30]]]`)}, 1, false},
+		{"multipolygon", GeoJSONGeometry{"MultiPolygon", json.RawMessage(`[[[[78,30],[79,30],[79,31],[78,30]]],[[[80,30],[81,30],[81,31],[80,30]]]]`)}, 2, false},
+		{"unsupported type", GeoJSONGeometry{"Point", json.RawMessage(`[78,30]`)}, 0, true},
+		{"ring too short", GeoJSONGeometry{"Polygon", json.RawMessage(`[[[78,30],[79,30],[78,30]]]`)}, 0, true},
+		{"ring not closed", GeoJSONGeometry{"Polygon", json.RawMessage(`[[[78,30],[79,30],[79,31],[78,31]]]`)}, 0, true},
+		{"latitude out of range", GeoJSONGeometry{"Polygon", json.RawMessage(`[[[78,30],[79,95],[79,31],[78,30]]]`)}, 0, true},
+		{"empty multipolygon", GeoJSONGeometry{"MultiPolygon", json.RawMessage(`[]`)}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			polygons, err := tt.geometry.polygons()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("polygons() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(polygons) != tt.wantCount {
+				t.Errorf("polygons() returned %d polygons, want %d", len(polygons), tt.wantCount)
+			}
+		})
+	}
+}
@@ -0,0 +1,565 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// governedOperations lists the transactions that only take effect through an approved proposal,
+// with the number of arguments each expects
+var governedOperations = map[string]int{
+	"CreateSeasonWindow":       1, // windowJSON
+	"UpdateSeasonWindow":       2, // windowID, windowJSON
+	"CreateHarvestLimit":       1, // limitJSON
+	"ResetSeasonalLimits":      1, // season
+	"SetGovernanceConfig":      1, // configJSON
+	"SetRetentionPolicy":       1, // policyJSON
+	"CreateApprovedZone":       1, // zoneJSON
+	"UpdateApprovedZone":       2, // zoneID, zoneJSON
+	"SetConservationStatus":    1, // statusJSON
+	"RemoveConservationStatus": 1, // statusID
+	"LiftSeasonClosure":        2, // windowID, closureID
+	"SetSeasonCalendar":        1, // calendarJSON
+}
+
+// defaultRequiredApprovals applies to operations without a GovernanceConfig
+const defaultRequiredApprovals = 2
+
+// GovernanceConfig defines who must approve proposals for a governed operation
+type GovernanceConfig struct {
+	ID                string   `json:"id"`
+	Type              string   `json:"type"`                   // "GovernanceConfig"
+	Operation         string   `json:"operation"`              // Governed transaction name
+	RequiredApprovals int      `json:"requiredApprovals"`      // Distinct organizations that must approve
+	ApproverOrgs      []string `json:"approverOrgs,omitempty"` // MSP IDs allowed to approve (empty = any org)
+	RequireRegulator  bool     `json:"requireRegulator"`       // At least one approval must come from a regulator
+	UpdatedBy         string   `json:"updatedBy"`
+	UpdatedAt         string   `json:"updatedAt"`
+}
+
+// ProposalApproval records a single approval or rejection of a proposal
+type ProposalApproval struct {
+	ApproverID string `json:"approverId"`
+	MSPID      string `json:"mspId"`
+	Role       string `json:"role"`
+	Decision   string `json:"decision"` // "approve", "reject"
+	Comment    string `json:"comment,omitempty"`
+	Timestamp  string `json:"timestamp"`
+}
+
+// GovernanceProposal represents a pending change to a governed operation
+type GovernanceProposal struct {
+	ID                string             `json:"id"`
+	Type              string             `json:"type"`      // "GovernanceProposal"
+	Operation         string             `json:"operation"` // Governed transaction name
+	Arguments         []string           `json:"arguments"`
+	Description       string             `json:"description"`
+	ProposedBy        string             `json:"proposedBy"`
+	ProposerMSP       string             `json:"proposerMsp"`
+	RequiredApprovals int                `json:"requiredApprovals"`
+	ApproverOrgs      []string           `json:"approverOrgs,omitempty"`
+	RequireRegulator  bool               `json:"requireRegulator"`
+	Approvals         []ProposalApproval `json:"approvals"`
+	Status            string             `json:"status"` // "pending", "approved", "rejected", "executed"
+	ExpiresAt         string             `json:"expiresAt,omitempty"`
+	ExecutedBy        string             `json:"executedBy,omitempty"`
+	ExecutedAt        string             `json:"executedAt,omitempty"`
+	CreatedAt         string             `json:"createdAt"`
+	UpdatedAt         string             `json:"updatedAt"`
+}
+
+// ProposalHistoryEntry represents one ledger modification of a proposal
+type ProposalHistoryEntry struct {
+	TxID      string              `json:"txId"`
+	Timestamp string              `json:"timestamp"`
+	IsDelete  bool                `json:"isDelete"`
+	Proposal  *GovernanceProposal `json:"proposal,omitempty"`
+}
+
+// proposalKey returns the ledger key for a proposal ID
+func proposalKey(proposalID string) string {
+	return "proposal_" + proposalID
+}
+
+// governanceConfigKey returns the ledger key for the governance config of an operation
+func governanceConfigKey(operation string) string {
+	return "govconfig_" + operation
+}
+
+// CreateProposal stores a governed operation as a pending proposal
+func (c *HerbalTraceContract) CreateProposal(ctx contractapi.TransactionContextInterface, proposalJSON string) error {
+	var proposal GovernanceProposal
+	err := json.Unmarshal([]byte(proposalJSON), &proposal)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal proposal JSON: %v", err)
+	}
+
+	// Validate required fields
+	if proposal.ID == "" {
+		return fmt.Errorf("proposal ID is required")
+	}
+	argCount, governed := governedOperations[proposal.Operation]
+	if !governed {
+		return fmt.Errorf("operation %s is not a governed operation", proposal.Operation)
+	}
+	if len(proposal.Arguments) != argCount {
+		return fmt.Errorf("operation %s expects %d argument(s), got %d", proposal.Operation, argCount, len(proposal.Arguments))
+	}
+	if proposal.ExpiresAt != "" {
+		if _, err := time.Parse(time.RFC3339, proposal.ExpiresAt); err != nil {
+			return fmt.Errorf("invalid expiry date format: %v", err)
+		}
+	}
+
+	// Check if proposal already exists
+	existingProposal, err := ctx.GetStub().GetState(proposalKey(proposal.ID))
+	if err != nil {
+		return fmt.Errorf("failed to check if proposal exists: %v", err)
+	}
+	if existingProposal != nil {
+		return fmt.Errorf("proposal with ID %s already exists", proposal.ID)
+	}
+
+	identity, err := getClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+	config, err := c.GetGovernanceConfig(ctx, proposal.Operation)
+	if err != nil {
+		return err
+	}
+
+	// Snapshot the approval rules so later config changes do not affect this proposal
+	proposal.Type = "GovernanceProposal"
+	proposal.ProposedBy = identity.EnrollmentID
+	proposal.ProposerMSP = identity.MSPID
+	proposal.RequiredApprovals = config.RequiredApprovals
+	proposal.ApproverOrgs = config.ApproverOrgs
+	proposal.RequireRegulator = config.RequireRegulator
+	proposal.Approvals = []ProposalApproval{}
+	proposal.Status = "pending"
+	proposal.ExecutedBy = ""
+	proposal.ExecutedAt = ""
+	proposal.CreatedAt = txTime.Format(time.RFC3339)
+	proposal.UpdatedAt = txTime.Format(time.RFC3339)
+
+	if err := c.putProposal(ctx, &proposal); err != nil {
+		return err
+	}
+
+	c.emitProposalEvent(ctx, "ProposalCreated", &proposal, identity.EnrollmentID)
+
+	return nil
+}
+
+// ApproveProposal records the approval of the submitter's organization
+func (c *HerbalTraceContract) ApproveProposal(ctx contractapi.TransactionContextInterface, proposalID string, comment string) error {
+	return c.decideProposal(ctx, proposalID, "approve", comment)
+}
+
+// RejectProposal rejects a pending proposal; a single eligible rejection closes it
+func (c *HerbalTraceContract) RejectProposal(ctx contractapi.TransactionContextInterface, proposalID string, reason string) error {
+	if reason == "" {
+		return fmt.Errorf("reason is required")
+	}
+	return c.decideProposal(ctx, proposalID, "reject", reason)
+}
+
+// ExecuteProposal applies an approved proposal to the ledger
+func (c *HerbalTraceContract) ExecuteProposal(ctx contractapi.TransactionContextInterface, proposalID string) error {
+	proposal, err := c.GetProposal(ctx, proposalID)
+	if err != nil {
+		return err
+	}
+	if proposal.Status != "approved" {
+		return fmt.Errorf("proposal %s is %s, not approved", proposalID, proposal.Status)
+	}
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+	if proposalExpired(proposal, txTime) {
+		return fmt.Errorf("proposal %s expired at %s", proposalID, proposal.ExpiresAt)
+	}
+
+	identity, err := getClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Apply the governed operation; a failure rolls back the whole transaction
+	args := proposal.Arguments
+	switch proposal.Operation {
+	case "CreateSeasonWindow":
+		err = c.CreateSeasonWindow(ctx, args[0])
+	case "UpdateSeasonWindow":
+		err = c.UpdateSeasonWindow(ctx, args[0], args[1])
+	case "CreateHarvestLimit":
+		err = c.CreateHarvestLimit(ctx, args[0])
+	case "ResetSeasonalLimits":
+		err = c.ResetSeasonalLimits(ctx, args[0])
+	case "SetGovernanceConfig":
+		err = c.SetGovernanceConfig(ctx, args[0])
+	case "SetRetentionPolicy":
+		err = c.SetRetentionPolicy(ctx, args[0])
+	case "CreateApprovedZone":
+		err = c.CreateApprovedZone(ctx, args[0])
+	case "UpdateApprovedZone":
+		err = c.UpdateApprovedZone(ctx, args[0], args[1])
+	case "SetConservationStatus":
+		err = c.SetConservationStatus(ctx, args[0])
+	case "RemoveConservationStatus":
+		err = c.RemoveConservationStatus(ctx, args[0])
+	case "LiftSeasonClosure":
+		err = c.LiftSeasonClosure(ctx, args[0], args[1])
+	case "SetSeasonCalendar":
+		err = c.SetSeasonCalendar(ctx, args[0])
+	default:
+		err = fmt.Errorf("operation %s is not a governed operation", proposal.Operation)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to execute proposal %s: %v", proposalID, err)
+	}
+
+	proposal.Status = "executed"
+	proposal.ExecutedBy = identity.EnrollmentID
+	proposal.ExecutedAt = txTime.Format(time.RFC3339)
+	proposal.UpdatedAt = proposal.ExecutedAt
+
+	if err := c.putProposal(ctx, proposal); err != nil {
+		return err
+	}
+
+	c.emitProposalEvent(ctx, "ProposalExecuted", proposal, identity.EnrollmentID)
+
+	return nil
+}
+
+// GetProposal retrieves a governance proposal by ID
+func (c *HerbalTraceContract) GetProposal(ctx contractapi.TransactionContextInterface, proposalID string) (*GovernanceProposal, error) {
+	if proposalID == "" {
+		return nil, fmt.Errorf("proposal ID is required")
+	}
+
+	proposalBytes, err := ctx.GetStub().GetState(proposalKey(proposalID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read proposal from ledger: %v", err)
+	}
+	if proposalBytes == nil {
+		return nil, fmt.Errorf("proposal with ID %s does not exist", proposalID)
+	}
+
+	var proposal GovernanceProposal
+	err = json.Unmarshal(proposalBytes, &proposal)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal proposal: %v", err)
+	}
+
+	return &proposal, nil
+}
+
+// QueryProposalsByStatus retrieves all proposals with a specific status
+func (c *HerbalTraceContract) QueryProposalsByStatus(ctx contractapi.TransactionContextInterface, status string) ([]*GovernanceProposal, error) {
+	if status == "" {
+		return nil, fmt.Errorf("status is required")
+	}
+
+	queryString := fmt.Sprintf(`{
+		"selector": {
+			"type": "GovernanceProposal",
+			"status": "%s"
+		}
+	}`, status)
+
+	resultsIterator, err := ctx.GetStub().GetQueryResult(queryString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query proposals: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	var proposals []*GovernanceProposal
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate query results: %v", err)
+		}
+
+		var proposal GovernanceProposal
+		err = json.Unmarshal(queryResponse.Value, &proposal)
+		if err != nil {
+			continue
+		}
+		proposals = append(proposals, &proposal)
+	}
+
+	return proposals, nil
+}
+
+// GetProposalHistory retrieves every recorded state of a proposal
+func (c *HerbalTraceContract) GetProposalHistory(ctx contractapi.TransactionContextInterface, proposalID string) ([]*ProposalHistoryEntry, error) {
+	if proposalID == "" {
+		return nil, fmt.Errorf("proposal ID is required")
+	}
+
+	historyIterator, err := ctx.GetStub().GetHistoryForKey(proposalKey(proposalID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get proposal history: %v", err)
+	}
+	defer historyIterator.Close()
+
+	var history []*ProposalHistoryEntry
+	for historyIterator.HasNext() {
+		modification, err := historyIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate proposal history: %v", err)
+		}
+
+		entry := &ProposalHistoryEntry{
+			TxID:      modification.TxId,
+			Timestamp: time.Unix(modification.Timestamp.Seconds, int64(modification.Timestamp.Nanos)).Format(time.RFC3339),
+			IsDelete:  modification.IsDelete,
+		}
+		if !modification.IsDelete {
+			var proposal GovernanceProposal
+			if err := json.Unmarshal(modification.Value, &proposal); err != nil {
+				continue
+			}
+			entry.Proposal = &proposal
+		}
+		history = append(history, entry)
+	}
+
+	return history, nil
+}
+
+// GetGovernanceConfig retrieves the approval rules of an operation, falling back to the default rules
+func (c *HerbalTraceContract) GetGovernanceConfig(ctx contractapi.TransactionContextInterface, operation string) (*GovernanceConfig, error) {
+	if _, governed := governedOperations[operation]; !governed {
+		return nil, fmt.Errorf("operation %s is not a governed operation", operation)
+	}
+
+	configBytes, err := ctx.GetStub().GetState(governanceConfigKey(operation))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read governance config: %v", err)
+	}
+	if configBytes == nil {
+		return &GovernanceConfig{
+			ID:                governanceConfigKey(operation),
+			Type:              "GovernanceConfig",
+			Operation:         operation,
+			RequiredApprovals: defaultRequiredApprovals,
+		}, nil
+	}
+
+	var config GovernanceConfig
+	err = json.Unmarshal(configBytes, &config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal governance config: %v", err)
+	}
+
+	return &config, nil
+}
+
+// SetGovernanceConfig validates and saves the approval rules of an operation. Operations without a
+// config require defaultRequiredApprovals approvals from distinct organizations.
+// (governed: applied through ExecuteProposal)
+func (c *HerbalTraceContract) SetGovernanceConfig(ctx contractapi.TransactionContextInterface, configJSON string) error {
+	var config GovernanceConfig
+	err := json.Unmarshal([]byte(configJSON), &config)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal governance config JSON: %v", err)
+	}
+
+	if _, governed := governedOperations[config.Operation]; !governed {
+		return fmt.Errorf("operation %s is not a governed operation", config.Operation)
+	}
+	if config.RequiredApprovals < 1 {
+		return fmt.Errorf("required approvals must be at least 1")
+	}
+	if len(config.ApproverOrgs) > 0 && config.RequiredApprovals > len(config.ApproverOrgs) {
+		return fmt.Errorf("required approvals (%d) exceed the number of approver orgs (%d)", config.RequiredApprovals, len(config.ApproverOrgs))
+	}
+
+	identity, err := getClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	config.ID = governanceConfigKey(config.Operation)
+	config.Type = "GovernanceConfig"
+	config.UpdatedBy = identity.EnrollmentID
+	config.UpdatedAt = txTime.Format(time.RFC3339)
+
+	configBytes, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to marshal governance config: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(config.ID, configBytes)
+	if err != nil {
+		return fmt.Errorf("failed to save governance config to ledger: %v", err)
+	}
+
+	// Emit event
+	eventPayload := map[string]interface{}{
+		"eventType":         "GovernanceConfigUpdated",
+		"operation":         config.Operation,
+		"requiredApprovals": config.RequiredApprovals,
+		"approverOrgs":      config.ApproverOrgs,
+		"requireRegulator":  config.RequireRegulator,
+		"updatedBy":         config.UpdatedBy,
+		"timestamp":         config.UpdatedAt,
+	}
+	eventBytes, _ := json.Marshal(eventPayload)
+	ctx.GetStub().SetEvent("GovernanceConfigUpdated", eventBytes)
+
+	return nil
+}
+
+// decideProposal records an approval or rejection by the submitter and updates the proposal status
+func (c *HerbalTraceContract) decideProposal(ctx contractapi.TransactionContextInterface, proposalID string, decision string, comment string) error {
+	proposal, err := c.GetProposal(ctx, proposalID)
+	if err != nil {
+		return err
+	}
+	if proposal.Status != "pending" {
+		return fmt.Errorf("proposal %s is %s, not pending", proposalID, proposal.Status)
+	}
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+	if proposalExpired(proposal, txTime) {
+		return fmt.Errorf("proposal %s expired at %s", proposalID, proposal.ExpiresAt)
+	}
+
+	identity, err := getClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	if len(proposal.ApproverOrgs) > 0 && !containsString(proposal.ApproverOrgs, identity.MSPID) {
+		return fmt.Errorf("access denied: %s is not an approver org for proposal %s", identity.MSPID, proposalID)
+	}
+	for _, approval := range proposal.Approvals {
+		if approval.ApproverID == identity.EnrollmentID && approval.MSPID == identity.MSPID {
+			return fmt.Errorf("%s (%s) has already decided on proposal %s", identity.EnrollmentID, identity.MSPID, proposalID)
+		}
+	}
+
+	proposal.Approvals = append(proposal.Approvals, ProposalApproval{
+		ApproverID: identity.EnrollmentID,
+		MSPID:      identity.MSPID,
+		Role:       identity.Role,
+		Decision:   decision,
+		Comment:    comment,
+		Timestamp:  txTime.Format(time.RFC3339),
+	})
+	proposal.UpdatedAt = txTime.Format(time.RFC3339)
+
+	eventName := "ProposalApproved"
+	if decision == "reject" {
+		proposal.Status = "rejected"
+		eventName = "ProposalRejected"
+	} else if proposalApprovalsMet(proposal) {
+		proposal.Status = "approved"
+	}
+
+	if err := c.putProposal(ctx, proposal); err != nil {
+		return err
+	}
+
+	c.emitProposalEvent(ctx, eventName, proposal, identity.EnrollmentID)
+
+	return nil
+}
+
+// putProposal saves a proposal to the ledger
+func (c *HerbalTraceContract) putProposal(ctx contractapi.TransactionContextInterface, proposal *GovernanceProposal) error {
+	proposalBytes, err := json.Marshal(proposal)
+	if err != nil {
+		return fmt.Errorf("failed to marshal proposal: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(proposalKey(proposal.ID), proposalBytes)
+	if err != nil {
+		return fmt.Errorf("failed to save proposal to ledger: %v", err)
+	}
+
+	return nil
+}
+
+// emitProposalEvent emits a proposal lifecycle event
+func (c *HerbalTraceContract) emitProposalEvent(ctx contractapi.TransactionContextInterface, eventName string, proposal *GovernanceProposal, actorID string) {
+	eventPayload := map[string]interface{}{
+		"eventType":         eventName,
+		"proposalId":        proposal.ID,
+		"operation":         proposal.Operation,
+		"status":            proposal.Status,
+		"approvals":         countApprovingOrgs(proposal),
+		"requiredApprovals": proposal.RequiredApprovals,
+		"actor":             actorID,
+		"timestamp":         proposal.UpdatedAt,
+	}
+	eventBytes, _ := json.Marshal(eventPayload)
+	ctx.GetStub().SetEvent(eventName, eventBytes)
+}
+
+// proposalApprovalsMet checks whether enough distinct organizations have approved a proposal
+func proposalApprovalsMet(proposal *GovernanceProposal) bool {
+	if countApprovingOrgs(proposal) < proposal.RequiredApprovals {
+		return false
+	}
+	if !proposal.RequireRegulator {
+		return true
+	}
+	for _, approval := range proposal.Approvals {
+		if approval.Decision == "approve" && approval.Role == RoleRegulator {
+			return true
+		}
+	}
+	return false
+}
+
+// countApprovingOrgs counts the distinct organizations that approved a proposal
+func countApprovingOrgs(proposal *GovernanceProposal) int {
+	orgs := map[string]bool{}
+	for _, approval := range proposal.Approvals {
+		if approval.Decision == "approve" {
+			orgs[approval.MSPID] = true
+		}
+	}
+	return len(orgs)
+}
+
+// proposalExpired checks whether a proposal had passed its expiry date at the transaction time
+func proposalExpired(proposal *GovernanceProposal, txTime time.Time) bool {
+	if proposal.ExpiresAt == "" {
+		return false
+	}
+	expiresAt, err := time.Parse(time.RFC3339, proposal.ExpiresAt)
+	if err != nil {
+		return false
+	}
+	return txTime.After(expiresAt)
+}
+
+// containsString checks whether a slice contains a value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
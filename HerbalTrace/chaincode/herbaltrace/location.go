@@ -0,0 +1,336 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// gpsPolicyKey is the ledger key of the GPS policy
+const gpsPolicyKey = "gpspolicy"
+
+// GPSPolicy configures the plausibility checks applied to the location of collection events
+type GPSPolicy struct {
+	ID                      string  `json:"id"`
+	Type                    string  `json:"type"`                    // "GPSPolicy"
+	MaxAccuracyMeters       float64 `json:"maxAccuracyMeters"`       // Fixes with a larger accuracy radius fail
+	AccuracyAction          string  `json:"accuracyAction"`          // "reject", "flag"
+	AltitudeToleranceMeters float64 `json:"altitudeToleranceMeters"` // Allowed distance outside a species' elevation range
+	MaxRepeatedFixes        int     `json:"maxRepeatedFixes"`        // Earlier identical fixes by a farmer before a fix is treated as spoofed
+	HistorySize             int     `json:"historySize"`             // Recent fixes kept per farmer
+	UpdatedBy               string  `json:"updatedBy"`
+	UpdatedAt               string  `json:"updatedAt"`
+}
+
+// defaultGPSPolicy applies until a GPS policy is set
+var defaultGPSPolicy = GPSPolicy{
+	ID:                      gpsPolicyKey,
+	Type:                    "GPSPolicy",
+	MaxAccuracyMeters:       50,
+	AccuracyAction:          "flag",
+	AltitudeToleranceMeters: 100,
+	MaxRepeatedFixes:        2,
+	HistorySize:             20,
+}
+
+// coordinateTolerance is the precision, in degrees, to which GPS fixes are compared
+const coordinateTolerance = 1e-7
+
+// FarmerLocationHistory holds a farmer's most recent GPS fixes with their exact coordinates. It is
+// stored in the farmer private data collection, so only peers of the collection's members can run the
+// plausibility and travel checks that read it; other peers fail instead of endorsing a different outcome.
+type FarmerLocationHistory struct {
+	ID       string        `json:"id"`
+	Type     string        `json:"type"` // "FarmerLocationHistory"
+	FarmerID string        `json:"farmerId"`
+	Fixes    []LocationFix `json:"fixes"` // Oldest first
+}
+
+// LocationFix is one GPS fix of a collection event
+type LocationFix struct {
+	EventID    string  `json:"eventId"`
+	Latitude   float64 `json:"latitude"`
+	Longitude  float64 `json:"longitude"`
+	Altitude   float64 `json:"altitude,omitempty"`
+	CapturedAt string  `json:"capturedAt"`
+}
+
+// locationIssue is a failed location plausibility check
+type locationIssue struct {
+	Code      string // Violation code and alert ID prefix, e.g. "gps"
+	AlertType string // "gps_accuracy", "altitude_violation", "gps_spoofing"
+	Severity  string
+	Message   string
+	Details   string
+	Reject    bool // False when the event is only flagged
+}
+
+// locationHistoryKey returns the ledger key of a farmer's location history
+func locationHistoryKey(farmerID string) string {
+	return "locationhistory_" + farmerID
+}
+
+// SetGPSPolicy replaces the GPS plausibility policy
+func (c *HerbalTraceContract) SetGPSPolicy(ctx contractapi.TransactionContextInterface, policyJSON string) error {
+	var policy GPSPolicy
+	err := json.Unmarshal([]byte(policyJSON), &policy)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal GPS policy JSON: %v", err)
+	}
+
+	if policy.MaxAccuracyMeters <= 0 {
+		return fmt.Errorf("max accuracy must be greater than zero")
+	}
+	if policy.AccuracyAction != "reject" && policy.AccuracyAction != "flag" {
+		return fmt.Errorf("accuracy action must be reject or flag")
+	}
+	if policy.AltitudeToleranceMeters < 0 {
+		return fmt.Errorf("altitude tolerance must not be negative")
+	}
+	if policy.MaxRepeatedFixes < 1 {
+		return fmt.Errorf("max repeated fixes must be at least 1")
+	}
+	if policy.HistorySize <= policy.MaxRepeatedFixes {
+		return fmt.Errorf("history size must be greater than max repeated fixes")
+	}
+
+	identity, err := getClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	policy.ID = gpsPolicyKey
+	policy.Type = "GPSPolicy"
+	policy.UpdatedBy = identity.EnrollmentID
+	policy.UpdatedAt = txTime.Format(time.RFC3339)
+
+	policyBytes, err := json.Marshal(policy)
+	if err != nil {
+		return fmt.Errorf("failed to marshal GPS policy: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(policy.ID, policyBytes)
+	if err != nil {
+		return fmt.Errorf("failed to save GPS policy to ledger: %v", err)
+	}
+
+	return nil
+}
+
+// GetGPSPolicy retrieves the GPS plausibility policy, falling back to the default policy
+func (c *HerbalTraceContract) GetGPSPolicy(ctx contractapi.TransactionContextInterface) (*GPSPolicy, error) {
+	policyBytes, err := ctx.GetStub().GetState(gpsPolicyKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GPS policy: %v", err)
+	}
+	if policyBytes == nil {
+		policy := defaultGPSPolicy
+		return &policy, nil
+	}
+
+	var policy GPSPolicy
+	err = json.Unmarshal(policyBytes, &policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal GPS policy: %v", err)
+	}
+
+	return &policy, nil
+}
+
+// checkLocationPlausibility checks the GPS fix of a collection event: its accuracy against the GPS
+// policy, its altitude against the species' elevation range, and the coordinates for spoofing (0,0 or
+// the same coordinates as too many of the farmer's recent fixes). Altitude is only checked when reported.
+func (c *HerbalTraceContract) checkLocationPlausibility(ctx contractapi.TransactionContextInterface, event *CollectionEvent, species *Species) ([]locationIssue, error) {
+	policy, err := c.GetGPSPolicy(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var issues []locationIssue
+	if event.Latitude == 0 && event.Longitude == 0 {
+		issues = append(issues, locationIssue{
+			Code:      "spoof",
+			AlertType: "gps_spoofing",
+			Severity:  "critical",
+			Message:   "Collection location is 0,0",
+			Details:   fmt.Sprintf("Event %s reports coordinates 0,0, which is a default or spoofed GPS fix", event.ID),
+			Reject:    true,
+		})
+		return issues, nil
+	}
+
+	if event.Accuracy < 0 {
+		return nil, fmt.Errorf("GPS accuracy must not be negative")
+	}
+	if event.Accuracy > policy.MaxAccuracyMeters {
+		issue := locationIssue{
+			Code:      "gps",
+			AlertType: "gps_accuracy",
+			Severity:  "medium",
+			Message:   "GPS accuracy below threshold",
+			Details: fmt.Sprintf("Event %s has a GPS accuracy of %.0fm, worse than the %.0fm threshold",
+				event.ID, event.Accuracy, policy.MaxAccuracyMeters),
+			Reject: policy.AccuracyAction == "reject",
+		}
+		if issue.Reject {
+			issue.Severity = "high"
+		}
+		issues = append(issues, issue)
+	}
+
+	if event.Altitude != 0 && species.hasAltitudeRange() {
+		if event.Altitude < species.MinAltitude-policy.AltitudeToleranceMeters ||
+			event.Altitude > species.MaxAltitude+policy.AltitudeToleranceMeters {
+			issues = append(issues, locationIssue{
+				Code:      "altitude",
+				AlertType: "altitude_violation",
+				Severity:  "high",
+				Message:   "Altitude outside species elevation range",
+				Details: fmt.Sprintf("Event %s was collected at %.0fm; species %s grows between %.0fm and %.0fm",
+					event.ID, event.Altitude, species.ID, species.MinAltitude, species.MaxAltitude),
+				Reject: true,
+			})
+		}
+	}
+
+	history, err := getLocationHistory(ctx, event.FarmerID)
+	if err != nil {
+		return nil, err
+	}
+	repeated := 0
+	for _, fix := range history.Fixes {
+		if sameCoordinates(fix.Latitude, fix.Longitude, event.Latitude, event.Longitude) {
+			repeated++
+		}
+	}
+	if repeated >= policy.MaxRepeatedFixes {
+		issues = append(issues, locationIssue{
+			Code:      "spoof",
+			AlertType: "gps_spoofing",
+			Severity:  "critical",
+			Message:   "Repeated identical coordinates",
+			Details: fmt.Sprintf("Event %s reports the same coordinates as %d of farmer %s's last %d collection events",
+				event.ID, repeated, event.FarmerID, len(history.Fixes)),
+			Reject: true,
+		})
+	}
+
+	return issues, nil
+}
+
+// sameCoordinates reports whether two GPS fixes have the same coordinates to the precision devices report
+func sameCoordinates(latitude1 float64, longitude1 float64, latitude2 float64, longitude2 float64) bool {
+	return math.Abs(latitude1-latitude2) < coordinateTolerance && math.Abs(longitude1-longitude2) < coordinateTolerance
+}
+
+// getLocationHistory reads a farmer's location history from the farmer private data collection, which
+// is empty when none was recorded. A peer that is not a member of the collection only holds the hash of
+// a recorded history, so it fails rather than check against an empty one.
+func getLocationHistory(ctx contractapi.TransactionContextInterface, farmerID string) (*FarmerLocationHistory, error) {
+	history := FarmerLocationHistory{
+		ID:       locationHistoryKey(farmerID),
+		Type:     "FarmerLocationHistory",
+		FarmerID: farmerID,
+		Fixes:    []LocationFix{},
+	}
+
+	historyBytes, err := ctx.GetStub().GetPrivateData(farmerPrivateCollection, history.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read location history: %v", err)
+	}
+	if historyBytes == nil {
+		historyHash, err := ctx.GetStub().GetPrivateDataHash(farmerPrivateCollection, history.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read location history hash: %v", err)
+		}
+		if historyHash != nil {
+			return nil, fmt.Errorf("location history of farmer %s is not available on this peer; collection events must be endorsed by peers of %s",
+				farmerID, farmerPrivateCollectionOrg)
+		}
+	}
+	if historyBytes != nil {
+		err = json.Unmarshal(historyBytes, &history)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal location history: %v", err)
+		}
+	}
+
+	return &history, nil
+}
+
+// recordLocationFix appends the GPS fix of a collection event to the farmer's location history,
+// keeping the number of fixes set by the GPS policy
+func (c *HerbalTraceContract) recordLocationFix(ctx contractapi.TransactionContextInterface, event *CollectionEvent, details *CollectionEventPrivateDetails) error {
+	policy, err := c.GetGPSPolicy(ctx)
+	if err != nil {
+		return err
+	}
+	history, err := getLocationHistory(ctx, event.FarmerID)
+	if err != nil {
+		return err
+	}
+
+	history.Fixes = append(history.Fixes, LocationFix{
+		EventID:    event.ID,
+		Latitude:   details.Latitude,
+		Longitude:  details.Longitude,
+		Altitude:   event.Altitude,
+		CapturedAt: event.CapturedAt,
+	})
+	if len(history.Fixes) > policy.HistorySize {
+		history.Fixes = history.Fixes[len(history.Fixes)-policy.HistorySize:]
+	}
+
+	return putLocationHistory(ctx, history)
+}
+
+// removeLocationFixes drops the fixes of erased collection events from a farmer's location history,
+// deleting the history once it is empty
+func removeLocationFixes(ctx contractapi.TransactionContextInterface, farmerID string, eventIDs []string) error {
+	history, err := getLocationHistory(ctx, farmerID)
+	if err != nil {
+		return err
+	}
+
+	kept := []LocationFix{}
+	for _, fix := range history.Fixes {
+		if !containsString(eventIDs, fix.EventID) {
+			kept = append(kept, fix)
+		}
+	}
+	if len(kept) == len(history.Fixes) {
+		return nil
+	}
+	if len(kept) == 0 {
+		err = ctx.GetStub().DelPrivateData(farmerPrivateCollection, history.ID)
+		if err != nil {
+			return fmt.Errorf("failed to delete location history of farmer %s: %v", farmerID, err)
+		}
+		return nil
+	}
+
+	history.Fixes = kept
+	return putLocationHistory(ctx, history)
+}
+
+// putLocationHistory writes a farmer's location history to the farmer private data collection
+func putLocationHistory(ctx contractapi.TransactionContextInterface, history *FarmerLocationHistory) error {
+	historyBytes, err := json.Marshal(history)
+	if err != nil {
+		return fmt.Errorf("failed to marshal location history: %v", err)
+	}
+
+	err = ctx.GetStub().PutPrivateData(farmerPrivateCollection, history.ID, historyBytes)
+	if err != nil {
+		return fmt.Errorf("failed to save location history: %v", err)
+	}
+
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"strings"
 
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
@@ -15,32 +16,52 @@ type HerbalTraceContract struct {
 
 // CollectionEvent represents a harvest/collection event with GPS data
 type CollectionEvent struct {
-	ID                string  `json:"id"`
-	Type              string  `json:"type"` // "CollectionEvent"
-	FarmerID          string  `json:"farmerId"`
-	FarmerName        string  `json:"farmerName"`
-	Species           string  `json:"species"`
-	CommonName        string  `json:"commonName"`
-	ScientificName    string  `json:"scientificName"`
-	Quantity          float64 `json:"quantity"`
-	Unit              string  `json:"unit"`
-	Latitude          float64 `json:"latitude"`
-	Longitude         float64 `json:"longitude"`
-	Altitude          float64 `json:"altitude,omitempty"`
-	Accuracy          float64 `json:"accuracy,omitempty"` // GPS accuracy in meters
-	HarvestDate       string  `json:"harvestDate"`
-	Timestamp         string  `json:"timestamp"`
-	HarvestMethod     string  `json:"harvestMethod"` // "manual", "mechanical"
-	PartCollected     string  `json:"partCollected"` // "leaf", "root", "flower", "seed", etc.
-	WeatherConditions string  `json:"weatherConditions,omitempty"`
-	SoilType          string  `json:"soilType,omitempty"`
-	Images            []string `json:"images,omitempty"` // IPFS hashes or URLs
-	ApprovedZone      bool    `json:"approvedZone"`
-	ZoneName          string  `json:"zoneName,omitempty"`
-	ConservationStatus string `json:"conservationStatus,omitempty"` // "Endangered", "Vulnerable", "Least Concern"
-	CertificationIDs  []string `json:"certificationIds,omitempty"` // Organic, Fair Trade, etc.
-	Status            string  `json:"status"` // "pending", "verified", "rejected"
-	NextStepID        string  `json:"nextStepId,omitempty"` // Link to quality test or processing
+	ID                  string                  `json:"id"`
+	Type                string                  `json:"type"` // "CollectionEvent"
+	FarmerID            string                  `json:"farmerId"`
+	FarmerName          string                  `json:"farmerName,omitempty"`   // Private: submitted via transient map, not stored publicly
+	SubmittedBy         string                  `json:"submittedBy,omitempty"`  // Enrollment ID of the submitting identity
+	SubmitterMSP        string                  `json:"submitterMsp,omitempty"` // MSP ID of the submitting identity
+	Species             string                  `json:"species"`
+	CommonName          string                  `json:"commonName"`
+	ScientificName      string                  `json:"scientificName"`
+	Quantity            float64                 `json:"quantity"`
+	Unit                string                  `json:"unit"`
+	CanonicalQuantity   float64                 `json:"canonicalQuantity"` // Quantity in the canonical unit (kg or l)
+	CanonicalUnit       string                  `json:"canonicalUnit"`
+	Latitude            float64                 `json:"latitude,omitempty"`            // Private: submitted via transient map, not stored publicly
+	Longitude           float64                 `json:"longitude,omitempty"`           // Private: submitted via transient map, not stored publicly
+	PrivateDataHash     string                  `json:"privateDataHash,omitempty"`     // SHA-256 of the salted private details
+	PrivateDataErasedAt string                  `json:"privateDataErasedAt,omitempty"` // Set when the private details were purged
+	Altitude            float64                 `json:"altitude,omitempty"`
+	Accuracy            float64                 `json:"accuracy,omitempty"` // GPS accuracy in meters
+	HarvestDate         string                  `json:"harvestDate"`
+	Timestamp           string                  `json:"timestamp"`
+	CapturedAt          string                  `json:"capturedAt,omitempty"`  // Original capture time on the device (RFC3339)
+	SubmittedAt         string                  `json:"submittedAt,omitempty"` // Ledger submission time (transaction timestamp)
+	DeviceID            string                  `json:"deviceId,omitempty"`
+	FarmerSignature     string                  `json:"farmerSignature,omitempty"` // Base64 device signature over the canonical event payload
+	SigningKeyID        string                  `json:"signingKeyId,omitempty"`
+	SignatureVerified   bool                    `json:"signatureVerified"`
+	HarvestMethod       string                  `json:"harvestMethod"` // "manual", "mechanical"
+	PartCollected       string                  `json:"partCollected"` // "leaf", "root", "flower", "seed", etc.
+	WeatherConditions   string                  `json:"weatherConditions,omitempty"`
+	SoilType            string                  `json:"soilType,omitempty"`
+	Images              []string                `json:"images,omitempty"` // IPFS hashes or URLs
+	ApprovedZone        bool                    `json:"approvedZone"`
+	ApprovedZoneID      string                  `json:"approvedZoneId,omitempty"`      // Zone whose geometry contains the location
+	ApprovedZoneVersion int                     `json:"approvedZoneVersion,omitempty"` // Version of that zone applied
+	ZoneName            string                  `json:"zoneName,omitempty"`
+	LocationFlags       []string                `json:"locationFlags,omitempty"`      // GPS plausibility checks the event was flagged for
+	PermitID            string                  `json:"permitId,omitempty"`           // Harvest permit for restricted species
+	SeasonWindowID      string                  `json:"seasonWindowId,omitempty"`     // Season window the harvest date matched
+	ConservationStatus  string                  `json:"conservationStatus,omitempty"` // "Endangered", "Vulnerable", "Least Concern"
+	CertificationIDs    []string                `json:"certificationIds,omitempty"`   // Organic, Fair Trade, etc.
+	Status              string                  `json:"status"`                       // "pending", "pending_review", "verified", "rejected"
+	BatchID             string                  `json:"batchId,omitempty"`            // Batch the verified event was aggregated into
+	Reviews             []CollectionEventReview `json:"reviews,omitempty"`            // Supervisor decisions, oldest first
+	Violations          []ComplianceViolation   `json:"violations,omitempty"`         // Failed compliance checks of a rejected event
+	NextStepID          string                  `json:"nextStepId,omitempty"`         // Link to quality test or processing
 }
 
 // QualityTest represents laboratory testing results
@@ -54,6 +75,9 @@ type QualityTest struct {
 	TestDate            string            `json:"testDate"`
 	Timestamp           string            `json:"timestamp"`
 	TestTypes           []string          `json:"testTypes"` // "moisture", "pesticide", "dna_barcode", "heavy_metals"
+	Matrix              string            `json:"matrix,omitempty"` // Sample matrix: "raw_herb", "powder", "extract"
+	AccreditationID     string            `json:"accreditationId,omitempty"` // Lab accreditation covering this test
+	AccreditationIssues []string          `json:"accreditationIssues,omitempty"` // Scope problems found at submission
 	MoistureContent     float64           `json:"moistureContent,omitempty"`
 	PesticideResults    map[string]string `json:"pesticideResults,omitempty"` // pesticide name -> "pass"/"fail"
 	HeavyMetals         map[string]float64 `json:"heavyMetals,omitempty"` // metal name -> ppm
@@ -65,61 +89,70 @@ type QualityTest struct {
 	CertificateID       string            `json:"certificateId"`
 	CertificateURL      string            `json:"certificateUrl,omitempty"`
 	TesterName          string            `json:"testerName"`
-	TesterSignature     string            `json:"testerSignature,omitempty"`
+	TesterID            string            `json:"testerId,omitempty"`
+	TesterSignature     string            `json:"testerSignature,omitempty"` // Base64 signature over the canonical result payload
+	SigningKeyID        string            `json:"signingKeyId,omitempty"`
+	SignatureVerified   bool              `json:"signatureVerified"`
+	SignatureIssue      string            `json:"signatureIssue,omitempty"`
 	Status              string            `json:"status"` // "pending", "approved", "rejected"
 	NextStepID          string            `json:"nextStepId,omitempty"`
 }
 
 // ProcessingStep represents processing/manufacturing steps
 type ProcessingStep struct {
-	ID                string            `json:"id"`
-	Type              string            `json:"type"` // "ProcessingStep"
-	PreviousStepID    string            `json:"previousStepId"` // CollectionEvent or QualityTest ID
-	BatchID           string            `json:"batchId"`
-	ProcessorID       string            `json:"processorId"`
-	ProcessorName     string            `json:"processorName"`
-	ProcessType       string            `json:"processType"` // "drying", "grinding", "extraction", "formulation"
-	ProcessDate       string            `json:"processDate"`
-	Timestamp         string            `json:"timestamp"`
-	InputQuantity     float64           `json:"inputQuantity"`
-	OutputQuantity    float64           `json:"outputQuantity"`
-	Unit              string            `json:"unit"`
-	Temperature       float64           `json:"temperature,omitempty"` // Celsius
-	Duration          float64           `json:"duration,omitempty"` // hours
-	Equipment         string            `json:"equipment,omitempty"`
-	Parameters        map[string]string `json:"parameters,omitempty"`
-	QualityChecks     []string          `json:"qualityChecks,omitempty"`
-	OperatorID        string            `json:"operatorId"`
-	OperatorName      string            `json:"operatorName"`
-	Location          string            `json:"location"`
-	Latitude          float64           `json:"latitude,omitempty"`
-	Longitude         float64           `json:"longitude,omitempty"`
-	Status            string            `json:"status"` // "in_progress", "completed", "failed"
-	NextStepID        string            `json:"nextStepId,omitempty"`
+	ID                      string            `json:"id"`
+	Type                    string            `json:"type"`           // "ProcessingStep"
+	PreviousStepID          string            `json:"previousStepId"` // CollectionEvent or QualityTest ID
+	BatchID                 string            `json:"batchId"`
+	ProcessorID             string            `json:"processorId"`
+	ProcessorName           string            `json:"processorName"`
+	ProcessType             string            `json:"processType"` // "drying", "grinding", "extraction", "formulation"
+	ProcessDate             string            `json:"processDate"`
+	Timestamp               string            `json:"timestamp"`
+	InputQuantity           float64           `json:"inputQuantity"`
+	OutputQuantity          float64           `json:"outputQuantity"`
+	Unit                    string            `json:"unit"`
+	CanonicalInputQuantity  float64           `json:"canonicalInputQuantity"`  // Input quantity in the canonical unit (kg or l)
+	CanonicalOutputQuantity float64           `json:"canonicalOutputQuantity"` // Output quantity in the canonical unit
+	CanonicalUnit           string            `json:"canonicalUnit"`
+	Temperature             float64           `json:"temperature,omitempty"` // Celsius
+	Duration                float64           `json:"duration,omitempty"`    // hours
+	Equipment               string            `json:"equipment,omitempty"`
+	Parameters              map[string]string `json:"parameters,omitempty"`
+	QualityChecks           []string          `json:"qualityChecks,omitempty"`
+	OperatorID              string            `json:"operatorId"`
+	OperatorName            string            `json:"operatorName"`
+	Location                string            `json:"location"`
+	Latitude                float64           `json:"latitude,omitempty"`
+	Longitude               float64           `json:"longitude,omitempty"`
+	Status                  string            `json:"status"` // "in_progress", "completed", "failed"
+	NextStepID              string            `json:"nextStepId,omitempty"`
 }
 
 // Product represents the final product with QR code
 type Product struct {
-	ID                string   `json:"id"`
-	Type              string   `json:"type"` // "Product"
-	ProductName       string   `json:"productName"`
-	ProductType       string   `json:"productType"` // "powder", "extract", "capsule", "oil"
-	ManufacturerID    string   `json:"manufacturerId"`
-	ManufacturerName  string   `json:"manufacturerName"`
-	BatchID           string   `json:"batchId"`
-	ManufactureDate   string   `json:"manufactureDate"`
-	ExpiryDate        string   `json:"expiryDate"`
-	Quantity          float64  `json:"quantity"`
-	Unit              string   `json:"unit"`
-	QRCode            string   `json:"qrCode"` // Unique QR code for consumer scanning
-	Ingredients       []string `json:"ingredients"`
+	ID                 string   `json:"id"`
+	Type               string   `json:"type"` // "Product"
+	ProductName        string   `json:"productName"`
+	ProductType        string   `json:"productType"` // "powder", "extract", "capsule", "oil"
+	ManufacturerID     string   `json:"manufacturerId"`
+	ManufacturerName   string   `json:"manufacturerName"`
+	BatchID            string   `json:"batchId"`
+	ManufactureDate    string   `json:"manufactureDate"`
+	ExpiryDate         string   `json:"expiryDate"`
+	Quantity           float64  `json:"quantity"`
+	Unit               string   `json:"unit"`
+	CanonicalQuantity  float64  `json:"canonicalQuantity"` // Quantity in the canonical unit (kg or l)
+	CanonicalUnit      string   `json:"canonicalUnit"`
+	QRCode             string   `json:"qrCode"` // Unique QR code for consumer scanning
+	Ingredients        []string `json:"ingredients"`
 	CollectionEventIDs []string `json:"collectionEventIds"` // Trace back to origins
-	QualityTestIDs    []string `json:"qualityTestIds"`
-	ProcessingStepIDs []string `json:"processingStepIds"`
-	Certifications    []string `json:"certifications"` // "Organic", "Fair Trade", "AYUSH Certified"
-	PackagingDate     string   `json:"packagingDate"`
-	Status            string   `json:"status"` // "manufactured", "distributed", "sold"
-	Timestamp         string   `json:"timestamp"`
+	QualityTestIDs     []string `json:"qualityTestIds"`
+	ProcessingStepIDs  []string `json:"processingStepIds"`
+	Certifications     []string `json:"certifications"` // "Organic", "Fair Trade", "AYUSH Certified"
+	PackagingDate      string   `json:"packagingDate"`
+	Status             string   `json:"status"` // "manufactured", "distributed", "sold"
+	Timestamp          string   `json:"timestamp"`
 }
 
 // Provenance represents the complete supply chain history (FHIR-style bundle)
@@ -142,162 +175,136 @@ func (c *HerbalTraceContract) InitLedger(ctx contractapi.TransactionContextInter
 	return nil
 }
 
-// CreateCollectionEvent records a new harvest/collection event with comprehensive validation
-func (c *HerbalTraceContract) CreateCollectionEvent(ctx contractapi.TransactionContextInterface, eventJSON string) error {
+// CreateCollectionEvent records a new harvest/collection event with comprehensive validation.
+// Malformed submissions return an error. An event that fails a compliance check is still recorded,
+// with status "rejected" and its violations, and the result reports the rejection.
+func (c *HerbalTraceContract) CreateCollectionEvent(ctx contractapi.TransactionContextInterface, eventJSON string) (*CollectionEventResult, error) {
 	var event CollectionEvent
 	err := json.Unmarshal([]byte(eventJSON), &event)
 	if err != nil {
-		return fmt.Errorf("failed to unmarshal event: %v", err)
+		return nil, fmt.Errorf("failed to unmarshal event: %v", err)
 	}
 
-	// 1. Validate season window
-	isInSeason, err := c.ValidateSeasonWindow(ctx, event.Species, event.HarvestDate, event.ZoneName)
+	if event.ID == "" {
+		return nil, fmt.Errorf("event ID is required")
+	}
+	existingEvent, err := ctx.GetStub().GetState(event.ID)
 	if err != nil {
-		return fmt.Errorf("season validation error: %v", err)
+		return nil, fmt.Errorf("failed to check if collection event exists: %v", err)
 	}
-	if !isInSeason {
-		// Create season violation alert
-		alertJSON := fmt.Sprintf(`{
-			"id": "alert_season_%s",
-			"alertType": "season_violation",
-			"severity": "high",
-			"entityId": "%s",
-			"entityType": "CollectionEvent",
-			"species": "%s",
-			"zone": "%s",
-			"message": "Harvest outside allowed season window",
-			"details": "Species %s harvested on %s in %s is outside the permitted season window"
-		}`, event.ID, event.ID, event.Species, event.ZoneName, event.Species, event.HarvestDate, event.ZoneName)
-		c.CreateAlert(ctx, alertJSON)
-		
-		event.ApprovedZone = false
-		event.Status = "rejected"
-		return fmt.Errorf("harvest outside allowed season window for species: %s", event.Species)
-	}
-
-	// 2. Validate geo-fencing
-	if !c.validateGeoFencing(event.Latitude, event.Longitude, event.Species) {
-		// Create zone violation alert
-		alertJSON := fmt.Sprintf(`{
-			"id": "alert_zone_%s",
-			"alertType": "zone_violation",
-			"severity": "high",
-			"entityId": "%s",
-			"entityType": "CollectionEvent",
-			"species": "%s",
-			"zone": "%s",
-			"message": "Collection location outside approved zone",
-			"details": "Harvest at coordinates (%.6f, %.6f) is outside approved zone for species %s"
-		}`, event.ID, event.ID, event.Species, event.ZoneName, event.Latitude, event.Longitude, event.Species)
-		c.CreateAlert(ctx, alertJSON)
-		
-		event.ApprovedZone = false
-		event.Status = "rejected"
-		return fmt.Errorf("collection location outside approved zone for species: %s", event.Species)
-	} else {
-		event.ApprovedZone = true
-		if event.Status == "" {
-			event.Status = "pending"
-		}
+	if existingEvent != nil {
+		return nil, fmt.Errorf("collection event %s already exists", event.ID)
 	}
 
-	// 3. Validate harvest limit (check before tracking)
-	currentSeason := getCurrentSeason()
-	withinLimit, err := c.ValidateHarvestLimit(ctx, event.Species, event.ZoneName, currentSeason, event.Quantity)
-	if err != nil {
-		return fmt.Errorf("harvest limit validation error: %v", err)
-	}
-	if !withinLimit {
-		// Create over-harvest alert
-		alertJSON := fmt.Sprintf(`{
-			"id": "alert_harvest_%s",
-			"alertType": "over_harvest",
-			"severity": "critical",
-			"entityId": "%s",
-			"entityType": "CollectionEvent",
-			"species": "%s",
-			"zone": "%s",
-			"message": "Harvest limit exceeded",
-			"details": "Attempting to harvest %.2f %s of %s in %s for season %s would exceed the limit"
-		}`, event.ID, event.ID, event.Species, event.ZoneName, event.Quantity, event.Unit, event.Species, event.ZoneName, currentSeason)
-		c.CreateAlert(ctx, alertJSON)
-		
-		event.Status = "rejected"
-		return fmt.Errorf("harvest limit exceeded for species: %s in zone: %s", event.Species, event.ZoneName)
-	}
-
-	// 4. Track harvest quantity (update the limit)
-	err = c.TrackHarvestQuantity(ctx, event.Species, event.ZoneName, currentSeason, event.Quantity)
-	if err != nil {
-		return fmt.Errorf("failed to track harvest quantity: %v", err)
-	}
-
-	// 5. Check if limit reached warning threshold
-	harvestStats, err := c.GetHarvestStatistics(ctx, event.Species, event.ZoneName, currentSeason)
-	if err == nil && harvestStats.Status == "warning" {
-		// Create warning alert
-		percentageUsed := (harvestStats.CurrentQuantity / harvestStats.MaxQuantity) * 100
-		alertJSON := fmt.Sprintf(`{
-			"id": "alert_warning_%s_%s_%s",
-			"alertType": "over_harvest",
-			"severity": "medium",
-			"entityId": "%s",
-			"entityType": "CollectionEvent",
-			"species": "%s",
-			"zone": "%s",
-			"message": "Harvest limit warning",
-			"details": "%.1f%% of harvest limit reached for %s in %s for season %s (%.2f / %.2f %s)"
-		}`, event.Species, event.ZoneName, currentSeason, event.ID, event.Species, event.ZoneName, 
-			percentageUsed, event.Species, event.ZoneName, currentSeason, 
-			harvestStats.CurrentQuantity, harvestStats.MaxQuantity, harvestStats.Unit)
-		c.CreateAlert(ctx, alertJSON)
-	}
-
-	// 6. Validate conservation status
-	if err := c.validateConservationLimits(ctx, event.Species, event.Quantity); err != nil {
-		// Create compliance alert
-		alertJSON := fmt.Sprintf(`{
-			"id": "alert_conservation_%s",
-			"alertType": "compliance",
-			"severity": "high",
-			"entityId": "%s",
-			"entityType": "CollectionEvent",
-			"species": "%s",
-			"zone": "%s",
-			"message": "Conservation limit violation",
-			"details": "Conservation limits exceeded for species: %s"
-		}`, event.ID, event.ID, event.Species, event.ZoneName, event.Species)
-		c.CreateAlert(ctx, alertJSON)
-		return err
+	// Bind the farmer to the submitting identity (admins may record on behalf of a farmer)
+	submitter, farmerID, err := resolveActor(ctx, event.FarmerID, true)
+	if err != nil {
+		return nil, err
+	}
+	event.FarmerID = farmerID
+	event.SubmittedBy = submitter.EnrollmentID
+	event.SubmitterMSP = submitter.MSPID
+	farmer, err := c.requireActiveParticipant(ctx, event.FarmerID, RoleFarmer)
+	if err != nil {
+		return nil, err
 	}
 
-	// 7. Save collection event
-	eventBytes, err := json.Marshal(event)
+	// Load farmer PII and exact coordinates from the transient map
+	privateDetails, err := readCollectionPrivateDetails(ctx, &event)
 	if err != nil {
-		return fmt.Errorf("failed to marshal event: %v", err)
+		return nil, err
 	}
 
-	err = ctx.GetStub().PutState(event.ID, eventBytes)
+	// Verify the farmer device signature, capture time, species, part and quantity; the first failed
+	// input check rejects the submission
+	submittedAt, err := getTxTime(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to save collection event: %v", err)
+		return nil, err
+	}
+	species, inputViolations, err := c.checkCollectionInput(ctx, &event, submittedAt)
+	if err != nil {
+		return nil, err
+	}
+	if len(inputViolations) > 0 {
+		return nil, fmt.Errorf("%s", inputViolations[0].Message)
+	}
+
+	// New events await supervisor verification; review, batch and compliance fields are set here
+	resetCollectionEvent(&event)
+
+	// 1-5. Run the compliance checks, then apply the accepted event's ledger updates. An event that
+	// fails a check is recorded as rejected with its violations, so that its alerts are kept. An event
+	// held for review does not use harvest limits, quotas or permits until a supervisor verifies it.
+	assessment, err := c.assessCollectionEvent(ctx, &event, farmer, species)
+	if err != nil {
+		return nil, err
+	}
+	if len(assessment.Violations) > 0 {
+		event.Status = "rejected"
+		event.Violations = assessment.Violations
+	} else if assessment.suspect {
+		event.Status = "pending_review"
+	} else {
+		if err := c.applyCollectionEvent(ctx, &event, assessment); err != nil {
+			return nil, err
+		}
+	}
+
+	// 6. Raise the alerts of the violations and flags; an alert that cannot be stored fails the transaction
+	result := CollectionEventResult{
+		EventID:    event.ID,
+		Accepted:   event.Status != "rejected",
+		Status:     event.Status,
+		Violations: event.Violations,
+	}
+	for i, alertJSON := range assessment.alerts {
+		if err := c.CreateAlert(ctx, alertJSON); err != nil {
+			return nil, fmt.Errorf("failed to raise alert %s: %v", assessment.AlertIDs[i], err)
+		}
+	}
+	result.AlertIDs = assessment.AlertIDs
+
+	// 7. Save private details, the farmer location history and daily activity, and the public collection event
+	if result.Accepted {
+		if err := c.recordLocationFix(ctx, &event, privateDetails); err != nil {
+			return nil, err
+		}
+		if err := recordDailyActivity(ctx, &event); err != nil {
+			return nil, err
+		}
+	}
+	if err := putCollectionPrivateDetails(ctx, &event, privateDetails); err != nil {
+		return nil, err
+	}
+	if err := c.putCollectionEvent(ctx, &event); err != nil {
+		return nil, err
 	}
 
 	// 8. Emit event
+	var violationCodes []string
+	for _, violation := range event.Violations {
+		violationCodes = append(violationCodes, violation.Code)
+	}
 	eventPayload := map[string]interface{}{
-		"eventType":  "CollectionEventCreated",
-		"eventId":    event.ID,
-		"farmerId":   event.FarmerID,
-		"species":    event.Species,
-		"quantity":   event.Quantity,
-		"unit":       event.Unit,
-		"zone":       event.ZoneName,
-		"status":     event.Status,
-		"timestamp":  event.Timestamp,
+		"eventType":         "CollectionEventCreated",
+		"eventId":           event.ID,
+		"farmerId":          event.FarmerID,
+		"species":           event.Species,
+		"quantity":          event.Quantity,
+		"unit":              event.Unit,
+		"canonicalQuantity": event.CanonicalQuantity,
+		"canonicalUnit":     event.CanonicalUnit,
+		"zone":              event.ZoneName,
+		"status":            event.Status,
+		"violations":        violationCodes,
+		"signed":            event.SignatureVerified,
+		"capturedAt":        event.CapturedAt,
+		"timestamp":         event.Timestamp,
 	}
 	eventPayloadBytes, _ := json.Marshal(eventPayload)
 	ctx.GetStub().SetEvent("CollectionEventCreated", eventPayloadBytes)
 
-	return nil
+	return &result, nil
 }
 
 // GetCollectionEvent retrieves a collection event by ID
@@ -327,22 +334,91 @@ func (c *HerbalTraceContract) CreateQualityTest(ctx contractapi.TransactionConte
 		return fmt.Errorf("failed to unmarshal test: %v", err)
 	}
 
+	// Check if quality test already exists; the ID must not overwrite a record of any other type
+	if test.ID == "" {
+		return fmt.Errorf("quality test ID is required")
+	}
+	existingTest, err := ctx.GetStub().GetState(test.ID)
+	if err != nil {
+		return fmt.Errorf("failed to check if quality test exists: %v", err)
+	}
+	if existingTest != nil {
+		return fmt.Errorf("quality test with ID %s already exists", test.ID)
+	}
+
+	lab, err := c.requireActiveParticipant(ctx, test.LabID, RoleLab)
+	if err != nil {
+		return err
+	}
+
+	// Check that the lab is accredited for the requested tests
+	accreditationID, scopeIssues, err := c.checkLabAccreditation(ctx, test)
+	if err != nil {
+		return fmt.Errorf("accreditation check error: %v", err)
+	}
+	test.AccreditationID = accreditationID
+	test.AccreditationIssues = scopeIssues
+	if len(scopeIssues) > 0 {
+		// Create accreditation compliance alert
+		alertJSON, _ := json.Marshal(Alert{
+			ID:         "alert_accreditation_" + test.ID,
+			AlertType:  "compliance",
+			Severity:   "high",
+			EntityID:   test.ID,
+			EntityType: "QualityTest",
+			Message:    "Quality test outside lab accreditation",
+			Details:    fmt.Sprintf("Test %s for batch %s by lab %s is not covered by a valid accreditation: %s", test.ID, test.BatchID, test.LabID, strings.Join(scopeIssues, "; ")),
+		})
+		if err := c.CreateAlert(ctx, string(alertJSON)); err != nil {
+			return fmt.Errorf("failed to raise alert alert_accreditation_%s: %v", test.ID, err)
+		}
+	}
+
+	// Verify the tester signature over the canonical result payload
+	signatureIssue, err := c.verifyTesterSignature(ctx, test)
+	if err != nil {
+		return fmt.Errorf("signature verification error: %v", err)
+	}
+	test.SignatureVerified = signatureIssue == ""
+	test.SignatureIssue = signatureIssue
+	if signatureIssue != "" {
+		if lab.SignaturePolicy == "reject" {
+			return fmt.Errorf("tester signature rejected for test %s: %s", test.ID, signatureIssue)
+		}
+
+		// Create signature compliance alert
+		alertJSON, _ := json.Marshal(Alert{
+			ID:         "alert_signature_" + test.ID,
+			AlertType:  "compliance",
+			Severity:   "high",
+			EntityID:   test.ID,
+			EntityType: "QualityTest",
+			Message:    "Quality test signature not verified",
+			Details:    fmt.Sprintf("Test %s for batch %s by lab %s: %s", test.ID, test.BatchID, test.LabID, signatureIssue),
+		})
+		if err := c.CreateAlert(ctx, string(alertJSON)); err != nil {
+			return fmt.Errorf("failed to raise alert alert_signature_%s: %v", test.ID, err)
+		}
+	}
+
 	// Validate quality gates
 	if !c.validateQualityGates(test) {
 		test.OverallResult = "fail"
 		test.Status = "rejected"
 		
 		// Create quality failure alert
-		alertJSON := fmt.Sprintf(`{
-			"id": "alert_quality_%s",
-			"alertType": "quality_failure",
-			"severity": "high",
-			"entityId": "%s",
-			"entityType": "QualityTest",
-			"message": "Quality test failed",
-			"details": "Batch %s failed quality testing at lab %s. Overall result: fail"
-		}`, test.ID, test.ID, test.BatchID, test.LabName)
-		c.CreateAlert(ctx, alertJSON)
+		alertJSON, _ := json.Marshal(Alert{
+			ID:         "alert_quality_" + test.ID,
+			AlertType:  "quality_failure",
+			Severity:   "high",
+			EntityID:   test.ID,
+			EntityType: "QualityTest",
+			Message:    "Quality test failed",
+			Details:    fmt.Sprintf("Batch %s failed quality testing at lab %s. Overall result: fail", test.BatchID, test.LabName),
+		})
+		if err := c.CreateAlert(ctx, string(alertJSON)); err != nil {
+			return fmt.Errorf("failed to raise alert alert_quality_%s: %v", test.ID, err)
+		}
 	} else {
 		test.OverallResult = "pass"
 		if test.Status == "" {
@@ -350,6 +426,11 @@ func (c *HerbalTraceContract) CreateQualityTest(ctx contractapi.TransactionConte
 		}
 	}
 
+	// Results from unaccredited labs or with unverified signatures are kept for audit but never approved
+	if len(test.AccreditationIssues) > 0 || !test.SignatureVerified {
+		test.Status = "rejected"
+	}
+
 	// Save quality test
 	testBytes, err := json.Marshal(test)
 	if err != nil {
@@ -361,6 +442,11 @@ func (c *HerbalTraceContract) CreateQualityTest(ctx contractapi.TransactionConte
 		return fmt.Errorf("failed to save quality test: %v", err)
 	}
 
+	// Later changes to the result require endorsement by the lab's organization
+	if err := setKeyEndorsement(ctx, test.ID, lab.Organization); err != nil {
+		return err
+	}
+
 	// Auto-update batch status if batch ID is provided
 	if test.BatchID != "" {
 		err = c.UpdateBatchStatus(ctx, test.BatchID, "testing")
@@ -371,13 +457,15 @@ func (c *HerbalTraceContract) CreateQualityTest(ctx contractapi.TransactionConte
 
 	// Emit event
 	eventPayload := map[string]interface{}{
-		"eventType":     "QualityTestCreated",
-		"testId":        test.ID,
-		"batchId":       test.BatchID,
-		"labId":         test.LabID,
-		"overallResult": test.OverallResult,
-		"status":        test.Status,
-		"timestamp":     test.Timestamp,
+		"eventType":         "QualityTestCreated",
+		"testId":            test.ID,
+		"batchId":           test.BatchID,
+		"labId":             test.LabID,
+		"overallResult":     test.OverallResult,
+		"status":            test.Status,
+		"accredited":        len(test.AccreditationIssues) == 0,
+		"signatureVerified": test.SignatureVerified,
+		"timestamp":         test.Timestamp,
 	}
 	eventPayloadBytes, _ := json.Marshal(eventPayload)
 	ctx.GetStub().SetEvent("QualityTestCreated", eventPayloadBytes)
@@ -412,6 +500,34 @@ func (c *HerbalTraceContract) CreateProcessingStep(ctx contractapi.TransactionCo
 		return fmt.Errorf("failed to unmarshal step: %v", err)
 	}
 
+	// Check if processing step already exists
+	if step.ID == "" {
+		return fmt.Errorf("processing step ID is required")
+	}
+	existingStep, err := ctx.GetStub().GetState(step.ID)
+	if err != nil {
+		return fmt.Errorf("failed to check if processing step exists: %v", err)
+	}
+	if existingStep != nil {
+		return fmt.Errorf("processing step with ID %s already exists", step.ID)
+	}
+
+	if _, err := c.requireActiveParticipant(ctx, step.ProcessorID, RoleProcessor); err != nil {
+		return err
+	}
+
+	// Record the input and output in the canonical unit alongside the submitted unit
+	if step.InputQuantity != 0 || step.OutputQuantity != 0 || step.Unit != "" {
+		step.CanonicalInputQuantity, step.CanonicalUnit, err = toCanonical(step.InputQuantity, step.Unit)
+		if err != nil {
+			return err
+		}
+		step.CanonicalOutputQuantity, _, err = toCanonical(step.OutputQuantity, step.Unit)
+		if err != nil {
+			return err
+		}
+	}
+
 	if step.Status == "" {
 		step.Status = "completed"
 	}
@@ -478,6 +594,30 @@ func (c *HerbalTraceContract) CreateProduct(ctx contractapi.TransactionContextIn
 		return fmt.Errorf("failed to unmarshal product: %v", err)
 	}
 
+	// Check if product already exists
+	if product.ID == "" {
+		return fmt.Errorf("product ID is required")
+	}
+	existingProduct, err := ctx.GetStub().GetState(product.ID)
+	if err != nil {
+		return fmt.Errorf("failed to check if product exists: %v", err)
+	}
+	if existingProduct != nil {
+		return fmt.Errorf("product with ID %s already exists", product.ID)
+	}
+
+	if _, err := c.requireActiveParticipant(ctx, product.ManufacturerID, RoleManufacturer); err != nil {
+		return err
+	}
+
+	// Record the quantity in the canonical unit alongside the submitted unit
+	if product.Quantity != 0 || product.Unit != "" {
+		product.CanonicalQuantity, product.CanonicalUnit, err = toCanonical(product.Quantity, product.Unit)
+		if err != nil {
+			return err
+		}
+	}
+
 	if product.Status == "" {
 		product.Status = "manufactured"
 	}
@@ -656,38 +796,6 @@ func (c *HerbalTraceContract) queryCollectionEvents(ctx contractapi.TransactionC
 	return events, nil
 }
 
-// validateGeoFencing checks if collection location is in approved zone
-func (c *HerbalTraceContract) validateGeoFencing(lat, lon float64, species string) bool {
-	// Simplified validation - in production, check against approved zones database
-	// For demo, allow most locations except some edge cases
-	if lat < -90 || lat > 90 || lon < -180 || lon > 180 {
-		return false
-	}
-	
-	// Add specific zone checks based on species and NMPB guidelines
-	// This is a placeholder for actual zone validation logic
-	return true
-}
-
-// validateConservationLimits checks species conservation limits
-func (c *HerbalTraceContract) validateConservationLimits(ctx contractapi.TransactionContextInterface, species string, quantity float64) error {
-	// Simplified validation - in production, check against conservation database
-	// and accumulated harvest quantities per season
-	
-	// Example: Block endangered species harvest
-	endangeredSpecies := map[string]bool{
-		"Aconitum heterophyllum": true,
-		"Nardostachys jatamansi": true,
-		"Picrorhiza kurroa":      true,
-	}
-	
-	if endangeredSpecies[species] {
-		return fmt.Errorf("species %s is endangered and requires special permit", species)
-	}
-	
-	return nil
-}
-
 // validateQualityGates validates quality test results against thresholds
 func (c *HerbalTraceContract) validateQualityGates(test QualityTest) bool {
 	// Check moisture content (should be < 12% for most herbs)
@@ -759,7 +867,10 @@ func (c *HerbalTraceContract) calculateSustainabilityScore(prov *Provenance) flo
 }
 
 func main() {
-	chaincode, err := contractapi.NewChaincode(&HerbalTraceContract{})
+	contract := new(HerbalTraceContract)
+	contract.BeforeTransaction = contract.checkAccess
+
+	chaincode, err := contractapi.NewChaincode(contract)
 	if err != nil {
 		log.Panicf("Error creating HerbalTrace chaincode: %v", err)
 	}
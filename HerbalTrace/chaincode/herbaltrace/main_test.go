@@ -0,0 +1,896 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// testStub is a MockStub that answers CouchDB rich queries from its world state, returns the hashes
+// of its private data and records chaincode events instead of queueing them on a bounded channel
+type testStub struct {
+	*shimtest.MockStub
+	events []string
+}
+
+// GetQueryResult runs the selector of a rich query against every JSON value in the world state.
+// It supports the operators the chaincode uses: equality, $or, $eq, $in, $gt, $exists and $elemMatch.
+func (s *testStub) GetQueryResult(query string) (shim.StateQueryIteratorInterface, error) {
+	var parsed struct {
+		Selector map[string]interface{} `json:"selector"`
+	}
+	if err := json.Unmarshal([]byte(query), &parsed); err != nil {
+		return nil, fmt.Errorf("invalid query %s: %v", query, err)
+	}
+
+	keys := make([]string, 0, len(s.State))
+	for key := range s.State {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// Matching entries are copied to a scratch stub and returned through its range iterator
+	results := shimtest.NewMockStub("query", nil)
+	results.MockTransactionStart("query")
+	for _, key := range keys {
+		var document map[string]interface{}
+		if err := json.Unmarshal(s.State[key], &document); err != nil {
+			continue
+		}
+		if matchesSelector(document, parsed.Selector) {
+			if err := results.PutState(key, s.State[key]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return shimtest.NewMockStateRangeQueryIterator(results, "", ""), nil
+}
+
+// GetPrivateDataHash returns the hash of a private data value, as every peer of the channel can
+func (s *testStub) GetPrivateDataHash(collection string, key string) ([]byte, error) {
+	value := s.PvtState[collection][key]
+	if value == nil {
+		return nil, nil
+	}
+	hash := sha256.Sum256(value)
+	return hash[:], nil
+}
+
+// SetEvent records the name of a chaincode event
+func (s *testStub) SetEvent(name string, payload []byte) error {
+	s.events = append(s.events, name)
+	return nil
+}
+
+// matchesSelector reports whether a JSON document matches a CouchDB selector
+func matchesSelector(document map[string]interface{}, selector map[string]interface{}) bool {
+	for field, condition := range selector {
+		if field == "$or" {
+			alternatives, _ := condition.([]interface{})
+			matched := false
+			for _, alternative := range alternatives {
+				if sub, ok := alternative.(map[string]interface{}); ok && matchesSelector(document, sub) {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return false
+			}
+			continue
+		}
+		value, present := document[field]
+		if !matchesCondition(value, present, condition) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesCondition reports whether a field value satisfies a selector condition
+func matchesCondition(value interface{}, present bool, condition interface{}) bool {
+	operators, ok := condition.(map[string]interface{})
+	if !ok || len(operators) == 0 {
+		return present && reflect.DeepEqual(value, condition)
+	}
+	for operator, argument := range operators {
+		switch operator {
+		case "$eq":
+			if !present || !reflect.DeepEqual(value, argument) {
+				return false
+			}
+		case "$exists":
+			if present != argument.(bool) {
+				return false
+			}
+		case "$gt":
+			text, isText := value.(string)
+			if !present || !isText || text <= argument.(string) {
+				return false
+			}
+		case "$in":
+			found := false
+			for _, candidate := range argument.([]interface{}) {
+				if present && reflect.DeepEqual(value, candidate) {
+					found = true
+				}
+			}
+			if !found {
+				return false
+			}
+		case "$elemMatch":
+			elements, _ := value.([]interface{})
+			found := false
+			for _, element := range elements {
+				if matchesCondition(element, true, argument) {
+					found = true
+				}
+			}
+			if !found {
+				return false
+			}
+		default:
+			if strings.HasPrefix(operator, "$") {
+				return false
+			}
+			return present && reflect.DeepEqual(value, condition)
+		}
+	}
+	return true
+}
+
+// testIdentity is a client identity with an enrollment ID, MSP and certificate attributes
+type testIdentity struct {
+	mspID        string
+	enrollmentID string
+	attributes   map[string]string
+}
+
+func (id *testIdentity) GetID() (string, error) { return id.enrollmentID, nil }
+
+func (id *testIdentity) GetMSPID() (string, error) { return id.mspID, nil }
+
+func (id *testIdentity) GetAttributeValue(name string) (string, bool, error) {
+	value, found := id.attributes[name]
+	return value, found, nil
+}
+
+func (id *testIdentity) AssertAttributeValue(name string, value string) error {
+	if id.attributes[name] != value {
+		return fmt.Errorf("attribute %s is not %s", name, value)
+	}
+	return nil
+}
+
+func (id *testIdentity) GetX509Certificate() (*x509.Certificate, error) {
+	return &x509.Certificate{Subject: pkix.Name{CommonName: id.enrollmentID}}, nil
+}
+
+var (
+	testAdmin  = &testIdentity{mspID: "FarmersCoopMSP", enrollmentID: "admin1", attributes: map[string]string{roleAttribute: RoleAdmin}}
+	testFarmer = &testIdentity{mspID: "FarmersCoopMSP", enrollmentID: "farmer1"}
+)
+
+// testLedger runs contract functions as transactions against a mock world state
+type testLedger struct {
+	t        *testing.T
+	stub     *testStub
+	contract *HerbalTraceContract
+	txCount  int
+}
+
+func newTestLedger(t *testing.T) *testLedger {
+	return &testLedger{
+		t:        t,
+		stub:     &testStub{MockStub: shimtest.NewMockStub("herbaltrace", nil)},
+		contract: new(HerbalTraceContract),
+	}
+}
+
+// invoke runs fn in a transaction submitted by identity at txTime with a transient map
+func (l *testLedger) invoke(identity *testIdentity, txTime time.Time, transient map[string][]byte, fn func(ctx contractapi.TransactionContextInterface) error) error {
+	l.txCount++
+	txID := fmt.Sprintf("tx%d", l.txCount)
+	l.stub.MockTransactionStart(txID)
+	defer l.stub.MockTransactionEnd(txID)
+	l.stub.TxTimestamp.Seconds = txTime.Unix()
+	l.stub.TxTimestamp.Nanos = int32(txTime.Nanosecond())
+	l.stub.TransientMap = transient
+
+	ctx := new(contractapi.TransactionContext)
+	ctx.SetStub(l.stub)
+	ctx.SetClientIdentity(identity)
+	return fn(ctx)
+}
+
+// mustInvoke runs fn as invoke does and fails the test on error
+func (l *testLedger) mustInvoke(identity *testIdentity, txTime time.Time, fn func(ctx contractapi.TransactionContextInterface) error) {
+	l.t.Helper()
+	if err := l.invoke(identity, txTime, nil, fn); err != nil {
+		l.t.Fatal(err)
+	}
+}
+
+// getState unmarshals the world state value of a key, reporting whether it exists
+func (l *testLedger) getState(key string, value interface{}) bool {
+	l.t.Helper()
+	valueBytes := l.stub.State[key]
+	if valueBytes == nil {
+		return false
+	}
+	if err := json.Unmarshal(valueBytes, value); err != nil {
+		l.t.Fatalf("failed to unmarshal %s: %v", key, err)
+	}
+	return true
+}
+
+const (
+	testZoneName = "Doon Valley"
+	testLimitID  = "limit_withania-somnifera_Doon_Valley_2025-Post-Monsoon"
+)
+
+var testSetupTime = time.Date(2025, 9, 1, 9, 0, 0, 0, time.UTC)
+
+// newCollectionTestLedger registers a verified farmer, Ashwagandha, an approved zone around
+// (30.35 N, 78.05 E) in Uttarakhand, a September-November season window and a 100 kg harvest
+// limit for the 2025 post-monsoon season
+func newCollectionTestLedger(t *testing.T) *testLedger {
+	l := newTestLedger(t)
+	c := l.contract
+	setup := []func(ctx contractapi.TransactionContextInterface) error{
+		func(ctx contractapi.TransactionContextInterface) error {
+			return c.RegisterSpecies(ctx, `{"id":"withania-somnifera","scientificName":"Withania somnifera",
+				"commonName":"Ashwagandha","permittedParts":["root"],"conservationCategory":"Least Concern"}`)
+		},
+		func(ctx contractapi.TransactionContextInterface) error {
+			return c.RegisterParticipant(ctx, `{"id":"farmer1","role":"farmer","name":"Ramesh Kumar",
+				"organization":"FarmersCoopMSP","kycStatus":"verified","region":"Uttarakhand"}`)
+		},
+		func(ctx contractapi.TransactionContextInterface) error {
+			return c.CreateApprovedZone(ctx, `{"zoneId":"Z1","name":"`+testZoneName+`","region":"Uttarakhand",
+				"species":["Ashwagandha"],"activeFrom":"2025-01-01","geometry":{"type":"Polygon",
+				"coordinates":[[[77.9,30.2],[78.2,30.2],[78.2,30.5],[77.9,30.5],[77.9,30.2]]]}}`)
+		},
+		func(ctx contractapi.TransactionContextInterface) error {
+			return c.CreateSeasonWindow(ctx, `{"id":"SW1","species":"Ashwagandha","startMonth":9,"endMonth":11,"region":"Uttarakhand"}`)
+		},
+		func(ctx contractapi.TransactionContextInterface) error {
+			return c.CreateHarvestLimit(ctx, `{"id":"`+testLimitID+`","species":"Ashwagandha","zone":"`+testZoneName+`","season":"2025-Post-Monsoon",
+				"maxQuantity":100,"unit":"kg","alertThreshold":80}`)
+		},
+	}
+	for _, fn := range setup {
+		l.mustInvoke(testAdmin, testSetupTime, fn)
+	}
+	return l
+}
+
+// testCollection describes a collection event submitted for the test farmer
+type testCollection struct {
+	id               string
+	farmerID         string // Defaults to the test farmer
+	quantity         float64
+	unit             string
+	latitude         float64
+	longitude        float64
+	harvestDate      string
+	capturedAt       time.Time
+	noPrivateDetails bool // Leave the private details out of the transient map
+}
+
+// request returns the event JSON and transient map of a collection event submission
+func (l *testLedger) request(collection testCollection) (string, map[string][]byte) {
+	l.t.Helper()
+	if collection.farmerID == "" {
+		collection.farmerID = "farmer1"
+	}
+	eventJSON, err := json.Marshal(CollectionEvent{
+		ID:            collection.id,
+		FarmerID:      collection.farmerID,
+		Species:       "Ashwagandha",
+		Quantity:      collection.quantity,
+		Unit:          collection.unit,
+		Accuracy:      5,
+		HarvestDate:   collection.harvestDate,
+		CapturedAt:    collection.capturedAt.Format(time.RFC3339),
+		HarvestMethod: "manual",
+		PartCollected: "root",
+	})
+	if err != nil {
+		l.t.Fatal(err)
+	}
+	if collection.noPrivateDetails {
+		return string(eventJSON), nil
+	}
+	privateJSON, err := json.Marshal(CollectionEventPrivateDetails{
+		FarmerName: "Ramesh Kumar",
+		Latitude:   collection.latitude,
+		Longitude:  collection.longitude,
+		Salt:       "5d41402abc4b2a76b9719d911017c592",
+	})
+	if err != nil {
+		l.t.Fatal(err)
+	}
+	return string(eventJSON), map[string][]byte{collectionPrivateTransientKey: privateJSON}
+}
+
+// submit records the collection event as the test farmer, with its private details in the transient map
+func (l *testLedger) submit(collection testCollection) (*CollectionEventResult, error) {
+	eventJSON, transient := l.request(collection)
+
+	var result *CollectionEventResult
+	err := l.invoke(testFarmer, collection.capturedAt.Add(10*time.Minute), transient,
+		func(ctx contractapi.TransactionContextInterface) error {
+			var err error
+			result, err = l.contract.CreateCollectionEvent(ctx, eventJSON)
+			return err
+		})
+	return result, err
+}
+
+// validate runs a dry run of the collection event submitted by identity
+func (l *testLedger) validate(identity *testIdentity, collection testCollection) (*CollectionEventValidation, error) {
+	eventJSON, transient := l.request(collection)
+
+	var result *CollectionEventValidation
+	err := l.invoke(identity, collection.capturedAt.Add(10*time.Minute), transient,
+		func(ctx contractapi.TransactionContextInterface) error {
+			var err error
+			result, err = l.contract.ValidateCollectionEvent(ctx, eventJSON)
+			return err
+		})
+	return result, err
+}
+
+// harvestedQuantity returns the quantity tracked against the test harvest limit
+func (l *testLedger) harvestedQuantity() float64 {
+	l.t.Helper()
+	var limit HarvestLimit
+	if !l.getState(testLimitID, &limit) {
+		l.t.Fatal("harvest limit not found")
+	}
+	return limit.CurrentQuantity
+}
+
+// locationHistory returns the test farmer's location history, or nil when none was recorded
+func (l *testLedger) locationHistory() *FarmerLocationHistory {
+	l.t.Helper()
+	historyBytes := l.stub.PvtState[farmerPrivateCollection][locationHistoryKey("farmer1")]
+	if historyBytes == nil {
+		return nil
+	}
+	var history FarmerLocationHistory
+	if err := json.Unmarshal(historyBytes, &history); err != nil {
+		l.t.Fatalf("failed to unmarshal location history: %v", err)
+	}
+	return &history
+}
+
+func TestCreateCollectionEventAccepted(t *testing.T) {
+	l := newCollectionTestLedger(t)
+
+	result, err := l.submit(testCollection{
+		id: "COL001", quantity: 10, unit: "kg", latitude: 30.3512, longitude: 78.0467,
+		harvestDate: "2025-10-05", capturedAt: time.Date(2025, 10, 5, 7, 30, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Accepted || result.Status != "pending" {
+		t.Errorf("result = accepted %v, status %q; want accepted, status pending", result.Accepted, result.Status)
+	}
+	if len(result.Violations) != 0 || len(result.AlertIDs) != 0 {
+		t.Errorf("result has violations %v and alerts %v, want none", result.Violations, result.AlertIDs)
+	}
+
+	var event CollectionEvent
+	if !l.getState("COL001", &event) {
+		t.Fatal("collection event not saved")
+	}
+	if event.Species != "withania-somnifera" || event.CanonicalQuantity != 10 || event.CanonicalUnit != "kg" {
+		t.Errorf("event species %q quantity %v %s, want withania-somnifera 10 kg", event.Species, event.CanonicalQuantity, event.CanonicalUnit)
+	}
+	if !event.ApprovedZone || event.ApprovedZoneID != "Z1" || event.ZoneName != testZoneName || event.SeasonWindowID != "SW1" {
+		t.Errorf("event zone %v %q %q, season window %q; want Z1 %s, SW1",
+			event.ApprovedZone, event.ApprovedZoneID, event.ZoneName, event.SeasonWindowID, testZoneName)
+	}
+	if event.Latitude != 0 || event.Longitude != 0 || event.FarmerName != "" || event.PrivateDataHash == "" {
+		t.Error("farmer name and coordinates must only be stored in the private collection")
+	}
+	if l.stub.PvtState[farmerPrivateCollection]["COL001"] == nil {
+		t.Error("private details not saved")
+	}
+
+	if quantity := l.harvestedQuantity(); quantity != 10 {
+		t.Errorf("harvest limit tracked %v kg, want 10", quantity)
+	}
+	if history := l.locationHistory(); history == nil || len(history.Fixes) != 1 {
+		t.Error("location history does not hold the event's fix")
+	}
+	if l.stub.State[locationHistoryKey("farmer1")] != nil {
+		t.Error("location history must only be stored in the private collection")
+	}
+	var activity FarmerDailyActivity
+	if !l.getState(dailyActivityKey("farmer1", "2025-10-05"), &activity) || len(activity.Events) != 1 {
+		t.Errorf("daily activity has %d events, want 1", len(activity.Events))
+	}
+}
+
+func TestCreateCollectionEventRejected(t *testing.T) {
+	capturedAt := time.Date(2025, 10, 5, 7, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name          string
+		collection    testCollection
+		wantViolation string
+		wantAlertID   string
+	}{
+		{
+			name: "outside approved zone",
+			collection: testCollection{id: "COL101", quantity: 10, unit: "kg", latitude: 30.9, longitude: 78.05,
+				harvestDate: "2025-10-05", capturedAt: capturedAt},
+			wantViolation: "zone_violation",
+			wantAlertID:   "alert_zone_COL101",
+		},
+		{
+			name: "outside season window",
+			collection: testCollection{id: "COL102", quantity: 10, unit: "kg", latitude: 30.3512, longitude: 78.0467,
+				harvestDate: "2025-07-05", capturedAt: capturedAt},
+			wantViolation: "season_violation",
+			wantAlertID:   "alert_season_COL102",
+		},
+		{
+			name: "over harvest limit",
+			collection: testCollection{id: "COL103", quantity: 1.5, unit: "quintal", latitude: 30.3512, longitude: 78.0467,
+				harvestDate: "2025-10-05", capturedAt: capturedAt},
+			wantViolation: "over_harvest",
+			wantAlertID:   "alert_harvest_COL103",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newCollectionTestLedger(t)
+
+			result, err := l.submit(tt.collection)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Accepted || result.Status != "rejected" {
+				t.Errorf("result = accepted %v, status %q; want rejected", result.Accepted, result.Status)
+			}
+			if len(result.Violations) != 1 || result.Violations[0].Code != tt.wantViolation {
+				t.Fatalf("violations = %v, want one %s", result.Violations, tt.wantViolation)
+			}
+			if result.Violations[0].AlertID != tt.wantAlertID {
+				t.Errorf("violation alert = %q, want %q", result.Violations[0].AlertID, tt.wantAlertID)
+			}
+
+			var alert Alert
+			if !l.getState(tt.wantAlertID, &alert) {
+				t.Errorf("alert %s not saved", tt.wantAlertID)
+			}
+			var event CollectionEvent
+			if !l.getState(tt.collection.id, &event) || event.Status != "rejected" || len(event.Violations) != 1 {
+				t.Errorf("rejected event not saved with its violation")
+			}
+			if quantity := l.harvestedQuantity(); quantity != 0 {
+				t.Errorf("rejected event tracked %v kg against the harvest limit", quantity)
+			}
+			if l.locationHistory() != nil {
+				t.Error("rejected event added to the location history")
+			}
+		})
+	}
+}
+
+func TestCreateCollectionEventHeldForReview(t *testing.T) {
+	l := newCollectionTestLedger(t)
+
+	capturedAt := time.Date(2025, 10, 5, 7, 30, 0, 0, time.UTC)
+	first, err := l.submit(testCollection{
+		id: "COL201", quantity: 10, unit: "kg", latitude: 30.3512, longitude: 78.0467,
+		harvestDate: "2025-10-05", capturedAt: capturedAt,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Status != "pending" {
+		t.Fatalf("first event status = %q, want pending", first.Status)
+	}
+
+	// The same quantity, in grams, captured five minutes later nearby is a near-duplicate
+	second, err := l.submit(testCollection{
+		id: "COL202", quantity: 10000, unit: "g", latitude: 30.3521, longitude: 78.0471,
+		harvestDate: "2025-10-05", capturedAt: capturedAt.Add(5 * time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !second.Accepted || second.Status != "pending_review" {
+		t.Errorf("result = accepted %v, status %q; want accepted, status pending_review", second.Accepted, second.Status)
+	}
+	if len(second.Violations) != 0 {
+		t.Errorf("violations = %v, want none", second.Violations)
+	}
+	if len(second.AlertIDs) != 1 || second.AlertIDs[0] != "alert_duplicate_COL202" {
+		t.Fatalf("alerts = %v, want alert_duplicate_COL202", second.AlertIDs)
+	}
+
+	var alert Alert
+	if !l.getState("alert_duplicate_COL202", &alert) || alert.AlertType != "suspicious_activity" {
+		t.Error("suspicious activity alert not saved")
+	}
+	var event CollectionEvent
+	if !l.getState("COL202", &event) || event.Status != "pending_review" {
+		t.Errorf("event status = %q, want pending_review", event.Status)
+	}
+	if quantity := l.harvestedQuantity(); quantity != 10 {
+		t.Errorf("harvest limit tracked %v kg while the event is held, want 10", quantity)
+	}
+
+	// Verifying the held event tracks its quantity
+	l.mustInvoke(testAdmin, capturedAt.Add(time.Hour), func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.VerifyCollectionEvent(ctx, "COL202", `{"reason":"spot check found two separate harvests"}`)
+	})
+	if !l.getState("COL202", &event) || event.Status != "verified" {
+		t.Errorf("event status = %q, want verified", event.Status)
+	}
+	if quantity := l.harvestedQuantity(); quantity != 20 {
+		t.Errorf("harvest limit tracked %v kg after verification, want 20", quantity)
+	}
+}
+
+func TestCreateRecordsRejectExistingIDs(t *testing.T) {
+	// Records share the key namespace, so a new record must not overwrite the farmer's participant record
+	key := participantKey("farmer1")
+	tests := []struct {
+		name   string
+		create func(c *HerbalTraceContract, ctx contractapi.TransactionContextInterface) error
+	}{
+		{"quality test", func(c *HerbalTraceContract, ctx contractapi.TransactionContextInterface) error {
+			return c.CreateQualityTest(ctx, `{"id":"`+key+`","labId":"LAB001"}`)
+		}},
+		{"processing step", func(c *HerbalTraceContract, ctx contractapi.TransactionContextInterface) error {
+			return c.CreateProcessingStep(ctx, `{"id":"`+key+`","processorId":"PROC001"}`)
+		}},
+		{"product", func(c *HerbalTraceContract, ctx contractapi.TransactionContextInterface) error {
+			return c.CreateProduct(ctx, `{"id":"`+key+`","manufacturerId":"MFR001"}`)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newCollectionTestLedger(t)
+			participant := append([]byte(nil), l.stub.State[key]...)
+
+			err := l.invoke(testAdmin, testSetupTime, nil, func(ctx contractapi.TransactionContextInterface) error {
+				return tt.create(l.contract, ctx)
+			})
+			if err == nil || !strings.Contains(err.Error(), "already exists") {
+				t.Errorf("error = %v, want an already exists error", err)
+			}
+			if string(l.stub.State[key]) != string(participant) {
+				t.Error("participant record was overwritten")
+			}
+		})
+	}
+}
+
+func TestCreateQualityTestAlertFailure(t *testing.T) {
+	l := newCollectionTestLedger(t)
+	l.mustInvoke(testAdmin, testSetupTime, func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.RegisterParticipant(ctx, `{"id":"LAB001","role":"lab","name":"Lab LAB001",
+			"organization":"TestingLabsMSP","kycStatus":"verified","region":"Uttarakhand"}`)
+	})
+	// The lab holds no accreditation, so the test raises an accreditation alert whose ID is taken
+	l.stub.State["alert_accreditation_QT001"] = []byte(`{"id":"alert_accreditation_QT001"}`)
+
+	err := l.invoke(testAdmin, testSetupTime, nil, func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.CreateQualityTest(ctx, `{"id":"QT001","batchId":"BATCH001","labId":"LAB001"}`)
+	})
+	if err == nil || !strings.Contains(err.Error(), "failed to raise alert alert_accreditation_QT001") {
+		t.Errorf("error = %v, want the alert failure", err)
+	}
+	if _, ok := l.stub.State["QT001"]; ok {
+		t.Error("quality test was saved without its alert")
+	}
+}
+
+func TestActorMSPRecorded(t *testing.T) {
+	l := newCollectionTestLedger(t)
+
+	var window SeasonWindow
+	if !l.getState("SW1", &window) || window.CreatedBy != "admin1" || window.CreatedByMSP != "FarmersCoopMSP" {
+		t.Errorf("season window created by %q (%q), want admin1 (FarmersCoopMSP)", window.CreatedBy, window.CreatedByMSP)
+	}
+	var limit HarvestLimit
+	if !l.getState(testLimitID, &limit) || limit.CreatedBy != "admin1" || limit.CreatedByMSP != "FarmersCoopMSP" {
+		t.Errorf("harvest limit created by %q (%q), want admin1 (FarmersCoopMSP)", limit.CreatedBy, limit.CreatedByMSP)
+	}
+
+	// Enrollment IDs are only unique within an organization's CA
+	labRegulator := &testIdentity{mspID: "TestingLabsMSP", enrollmentID: "admin1", attributes: map[string]string{roleAttribute: RoleRegulator}}
+	l.mustInvoke(testAdmin, testSetupTime, func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.CreateAlert(ctx, `{"id":"ALERT001","alertType":"system","severity":"low","message":"Test alert"}`)
+	})
+	err := l.invoke(labRegulator, testSetupTime, nil, func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.AcknowledgeAlert(ctx, "ALERT001", "regulator1")
+	})
+	if err == nil || !strings.Contains(err.Error(), "does not match submitter") {
+		t.Errorf("error = %v, want an actor mismatch", err)
+	}
+	l.mustInvoke(labRegulator, testSetupTime, func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.AcknowledgeAlert(ctx, "ALERT001", "")
+	})
+	l.mustInvoke(testAdmin, testSetupTime, func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.ResolveAlert(ctx, "ALERT001", "admin1", "checked")
+	})
+
+	var alert Alert
+	l.getState("ALERT001", &alert)
+	if alert.AcknowledgedBy != "admin1" || alert.AcknowledgedByMSP != "TestingLabsMSP" {
+		t.Errorf("alert acknowledged by %q (%q), want admin1 (TestingLabsMSP)", alert.AcknowledgedBy, alert.AcknowledgedByMSP)
+	}
+	if alert.ResolvedBy != "admin1" || alert.ResolvedByMSP != "FarmersCoopMSP" {
+		t.Errorf("alert resolved by %q (%q), want admin1 (FarmersCoopMSP)", alert.ResolvedBy, alert.ResolvedByMSP)
+	}
+}
+
+func TestRequireActiveParticipantBinding(t *testing.T) {
+	l := newCollectionTestLedger(t)
+	for _, id := range []string{"LAB001", "LAB002"} {
+		id := id
+		l.mustInvoke(testAdmin, testSetupTime, func(ctx contractapi.TransactionContextInterface) error {
+			return l.contract.RegisterParticipant(ctx, `{"id":"`+id+`","role":"lab","name":"Lab `+id+`",
+				"organization":"TestingLabsMSP","kycStatus":"verified","region":"Uttarakhand"}`)
+		})
+	}
+
+	labTester := func(participantID string) *testIdentity {
+		attributes := map[string]string{}
+		if participantID != "" {
+			attributes[participantAttribute] = participantID
+		}
+		return &testIdentity{mspID: "TestingLabsMSP", enrollmentID: "tester1", attributes: attributes}
+	}
+	tests := []struct {
+		name          string
+		identity      *testIdentity
+		participantID string
+		role          string
+		wantErr       bool
+	}{
+		{"lab member acting for their lab", labTester("LAB001"), "LAB001", RoleLab, false},
+		{"lab member acting for another lab", labTester("LAB001"), "LAB002", RoleLab, true},
+		{"lab member without a participant attribute", labTester(""), "LAB001", RoleLab, true},
+		{"farmer acting for themselves", testFarmer, "farmer1", RoleFarmer, false},
+		{"farmer acting for another farmer", &testIdentity{mspID: "FarmersCoopMSP", enrollmentID: "farmer2"}, "farmer1", RoleFarmer, true},
+		{"member of another organization", &testIdentity{mspID: "ProcessorsMSP", enrollmentID: "LAB001"}, "LAB001", RoleLab, true},
+		{"admin acting for any participant", testAdmin, "LAB002", RoleLab, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := l.invoke(tt.identity, testSetupTime, nil, func(ctx contractapi.TransactionContextInterface) error {
+				_, err := l.contract.requireActiveParticipant(ctx, tt.participantID, tt.role)
+				return err
+			})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("requireActiveParticipant(%s) error = %v, wantErr %v", tt.participantID, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateCollectionEventReportsEveryViolation(t *testing.T) {
+	capturedAt := time.Date(2025, 10, 5, 7, 30, 0, 0, time.UTC)
+	inZone := testCollection{id: "COL301", quantity: 10, unit: "kg", latitude: 30.3512, longitude: 78.0467,
+		harvestDate: "2025-10-05", capturedAt: capturedAt}
+
+	tests := []struct {
+		name           string
+		identity       *testIdentity
+		modify         func(collection *testCollection)
+		wantViolations []string
+	}{
+		{"valid event", testFarmer, func(collection *testCollection) {}, nil},
+		{"unknown farmer", testAdmin, func(collection *testCollection) { collection.farmerID = "farmer9" },
+			[]string{"farmer_refused"}},
+		{"missing private details", testFarmer, func(collection *testCollection) { collection.noPrivateDetails = true },
+			[]string{"invalid_private_details"}},
+		{"unknown unit outside zone", testFarmer, func(collection *testCollection) {
+			collection.unit = "bushel"
+			collection.latitude, collection.longitude = 30.9, 78.05
+		}, []string{"invalid_unit", "zone_violation"}},
+		{"volume against a mass harvest limit", testFarmer, func(collection *testCollection) { collection.unit = "l" },
+			[]string{"invalid_unit"}},
+		{"unknown farmer over the harvest limit", testAdmin, func(collection *testCollection) {
+			collection.farmerID = "farmer9"
+			collection.quantity, collection.unit = 1.5, "quintal"
+		}, []string{"farmer_refused", "over_harvest"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newCollectionTestLedger(t)
+			collection := inZone
+			tt.modify(&collection)
+
+			result, err := l.validate(tt.identity, collection)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var codes []string
+			for _, violation := range result.Violations {
+				codes = append(codes, violation.Code)
+			}
+			if !reflect.DeepEqual(codes, tt.wantViolations) {
+				t.Errorf("violations = %v, want %v", result.Violations, tt.wantViolations)
+			}
+			if result.Valid != (len(tt.wantViolations) == 0) {
+				t.Errorf("valid = %v with violations %v", result.Valid, codes)
+			}
+			if l.stub.State["COL301"] != nil {
+				t.Error("dry run saved the collection event")
+			}
+		})
+	}
+}
+
+func TestCollectionAssessmentAlert(t *testing.T) {
+	// Free text with quotes and newlines must not break the alert JSON
+	event := &CollectionEvent{ID: "COL401", Species: "withania-somnifera", ZoneName: `Doon "East" Valley`}
+	var a collectionAssessment
+	a.violate("zone_violation", "alert_zone_COL401", "zone_violation", "high", event,
+		`Location outside "approved" zone`, "Event COL401 was captured\nat the \"ridge\"")
+
+	if len(a.alerts) != 1 {
+		t.Fatalf("queued %d alerts, want 1", len(a.alerts))
+	}
+	var alert Alert
+	if err := json.Unmarshal([]byte(a.alerts[0]), &alert); err != nil {
+		t.Fatalf("alert JSON %s is invalid: %v", a.alerts[0], err)
+	}
+	want := Alert{
+		ID:         "alert_zone_COL401",
+		AlertType:  "zone_violation",
+		Severity:   "high",
+		EntityID:   "COL401",
+		EntityType: "CollectionEvent",
+		Species:    "withania-somnifera",
+		Zone:       `Doon "East" Valley`,
+		Message:    `Location outside "approved" zone`,
+		Details:    "Event COL401 was captured\nat the \"ridge\"",
+	}
+	if alert != want {
+		t.Errorf("alert = %+v, want %+v", alert, want)
+	}
+	if len(a.Violations) != 1 || a.Violations[0].Code != "zone_violation" || a.Violations[0].AlertID != "alert_zone_COL401" {
+		t.Errorf("violations = %v, want zone_violation with alert_zone_COL401", a.Violations)
+	}
+}
+
+// newBatchTestLedger records a verified 10 kg collection event COL001 for the test farmer and
+// registers farmer3, a farmer of another organization
+func newBatchTestLedger(t *testing.T) *testLedger {
+	l := newCollectionTestLedger(t)
+	capturedAt := time.Date(2025, 10, 5, 7, 30, 0, 0, time.UTC)
+	if _, err := l.submit(testCollection{id: "COL001", quantity: 10, unit: "kg", latitude: 30.3512, longitude: 78.0467,
+		harvestDate: "2025-10-05", capturedAt: capturedAt}); err != nil {
+		t.Fatal(err)
+	}
+	l.mustInvoke(testAdmin, capturedAt.Add(time.Hour), func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.VerifyCollectionEvent(ctx, "COL001", `{"reason":"spot checked"}`)
+	})
+	l.mustInvoke(testAdmin, capturedAt.Add(time.Hour), func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.RegisterParticipant(ctx, `{"id":"farmer3","role":"farmer","name":"Sunita Devi",
+			"organization":"ProcessorsMSP","kycStatus":"verified","region":"Uttarakhand"}`)
+	})
+	return l
+}
+
+func TestCreateBatchCollectionEvents(t *testing.T) {
+	tests := []struct {
+		name      string
+		identity  *testIdentity
+		batchJSON string
+		wantErr   string
+	}{
+		{"farmer's own verified event", testFarmer,
+			`{"id":"B001","species":"Ashwagandha","totalQuantity":10,"unit":"kg","collectionEventIds":["COL001"]}`, ""},
+		{"no collection events", testFarmer,
+			`{"id":"B001","species":"Ashwagandha","totalQuantity":10,"unit":"kg","collectionEventIds":[]}`, "at least one collection event"},
+		{"event of a farmer in another cooperative", testAdmin,
+			`{"id":"B001","species":"Ashwagandha","totalQuantity":10,"unit":"kg","createdBy":"farmer3","collectionEventIds":["COL001"]}`, "not by farmer farmer3"},
+		{"record that is not a collection event", testFarmer,
+			`{"id":"B001","species":"Ashwagandha","totalQuantity":10,"unit":"kg","collectionEventIds":["` + participantKey("farmer1") + `"]}`, "is not a collection event"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newBatchTestLedger(t)
+			err := l.invoke(tt.identity, testSetupTime.AddDate(0, 2, 0), nil, func(ctx contractapi.TransactionContextInterface) error {
+				return l.contract.CreateBatch(ctx, tt.batchJSON)
+			})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				var event CollectionEvent
+				if !l.getState("COL001", &event) || event.BatchID != "B001" {
+					t.Errorf("event batch = %q, want B001", event.BatchID)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBatchEndorsementOrgs(t *testing.T) {
+	l := newBatchTestLedger(t)
+	txTime := testSetupTime.AddDate(0, 2, 0)
+	endorsementOrgs := func() []string {
+		var orgs []string
+		l.mustInvoke(testAdmin, txTime, func(ctx contractapi.TransactionContextInterface) error {
+			var err error
+			orgs, err = l.contract.GetEndorsementOrgs(ctx, "B001")
+			return err
+		})
+		sort.Strings(orgs)
+		return orgs
+	}
+
+	l.mustInvoke(testFarmer, txTime, func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.CreateBatch(ctx, `{"id":"B001","species":"Ashwagandha","totalQuantity":10,"unit":"kg","collectionEventIds":["COL001"]}`)
+	})
+	if orgs := endorsementOrgs(); !reflect.DeepEqual(orgs, []string{"FarmersCoopMSP"}) {
+		t.Errorf("endorsing orgs before assignment = %v, want [FarmersCoopMSP]", orgs)
+	}
+
+	l.mustInvoke(testAdmin, txTime, func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.RegisterParticipant(ctx, `{"id":"PROC001","role":"processor","name":"Himalayan Extracts",
+			"organization":"ProcessorsMSP","kycStatus":"verified","region":"Uttarakhand"}`)
+	})
+	l.mustInvoke(testAdmin, txTime, func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.AssignBatchToProcessor(ctx, "B001", "PROC001", "Himalayan Extracts", "")
+	})
+	want := []string{"FarmersCoopMSP", "ProcessorsMSP"}
+	if orgs := endorsementOrgs(); !reflect.DeepEqual(orgs, want) {
+		t.Errorf("endorsing orgs after assignment = %v, want %v", orgs, want)
+	}
+
+	// Status updates, including those made by quality tests, processing steps and products, keep
+	// requiring both organizations
+	l.mustInvoke(testAdmin, txTime, func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.UpdateBatchStatus(ctx, "B001", "testing")
+	})
+	if orgs := endorsementOrgs(); !reflect.DeepEqual(orgs, want) {
+		t.Errorf("endorsing orgs after status update = %v, want %v", orgs, want)
+	}
+}
+
+func TestReviewCollectionEventRejectsOtherRecords(t *testing.T) {
+	l := newCollectionTestLedger(t)
+	for _, review := range []func(ctx contractapi.TransactionContextInterface) error{
+		func(ctx contractapi.TransactionContextInterface) error {
+			return l.contract.VerifyCollectionEvent(ctx, participantKey("farmer1"), `{}`)
+		},
+		func(ctx contractapi.TransactionContextInterface) error {
+			return l.contract.RejectCollectionEvent(ctx, participantKey("farmer1"), `{"reason":"not a harvest"}`)
+		},
+	} {
+		err := l.invoke(testAdmin, testSetupTime, nil, review)
+		if err == nil || !strings.Contains(err.Error(), "is not a collection event") {
+			t.Errorf("error = %v, want a not a collection event error", err)
+		}
+	}
+}
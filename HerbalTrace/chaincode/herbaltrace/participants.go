@@ -0,0 +1,381 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Participant represents a registered supply chain actor (farmer, lab, processor, manufacturer)
+type Participant struct {
+	ID              string `json:"id"`
+	Type            string `json:"type"` // "Participant"
+	Role            string `json:"role"` // "farmer", "lab", "processor", "manufacturer"
+	Name            string `json:"name"`
+	Organization    string `json:"organization"` // MSP ID of the owning organization
+	KYCStatus       string `json:"kycStatus"`    // "pending", "verified", "rejected"
+	KYCReference    string `json:"kycReference,omitempty"`
+	Region          string `json:"region"`                    // Contact region / district
+	SignaturePolicy string `json:"signaturePolicy,omitempty"` // Labs: "reject" or "flag" unsigned/invalid results (default "flag")
+	Active          bool   `json:"active"`
+	SuspendedReason string `json:"suspendedReason,omitempty"`
+	CreatedBy       string `json:"createdBy"`
+	CreatedAt       string `json:"createdAt"`
+	UpdatedAt       string `json:"updatedAt"`
+}
+
+// participantKey returns the ledger key for a participant ID
+func participantKey(participantID string) string {
+	return "participant_" + participantID
+}
+
+// RegisterParticipant registers a new participant on the ledger
+func (c *HerbalTraceContract) RegisterParticipant(ctx contractapi.TransactionContextInterface, participantJSON string) error {
+	var participant Participant
+	err := json.Unmarshal([]byte(participantJSON), &participant)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal participant JSON: %v", err)
+	}
+
+	// Validate required fields
+	if participant.ID == "" {
+		return fmt.Errorf("participant ID is required")
+	}
+	if participant.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if err := validateOrganization(participant.Organization); err != nil {
+		return err
+	}
+	if err := validateParticipantRole(participant.Role); err != nil {
+		return err
+	}
+	if participant.KYCStatus == "" {
+		participant.KYCStatus = "pending"
+	}
+	if err := validateKYCStatus(participant.KYCStatus); err != nil {
+		return err
+	}
+	if err := validateSignaturePolicy(participant.SignaturePolicy); err != nil {
+		return err
+	}
+
+	// Check if participant already exists
+	existingParticipant, err := ctx.GetStub().GetState(participantKey(participant.ID))
+	if err != nil {
+		return fmt.Errorf("failed to check if participant exists: %v", err)
+	}
+	if existingParticipant != nil {
+		return fmt.Errorf("participant with ID %s already exists", participant.ID)
+	}
+
+	identity, err := getClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Set default values
+	participant.Type = "Participant"
+	participant.Active = true
+	participant.SuspendedReason = ""
+	participant.CreatedBy = identity.EnrollmentID
+	participant.CreatedAt = txTime.Format(time.RFC3339)
+	participant.UpdatedAt = txTime.Format(time.RFC3339)
+
+	if err := c.putParticipant(ctx, &participant); err != nil {
+		return err
+	}
+
+	// Emit event
+	eventPayload := map[string]interface{}{
+		"eventType":     "ParticipantRegistered",
+		"participantId": participant.ID,
+		"role":          participant.Role,
+		"organization":  participant.Organization,
+		"kycStatus":     participant.KYCStatus,
+		"timestamp":     participant.CreatedAt,
+	}
+	eventBytes, _ := json.Marshal(eventPayload)
+	ctx.GetStub().SetEvent("ParticipantRegistered", eventBytes)
+
+	return nil
+}
+
+// UpdateParticipant updates the profile and KYC status of an existing participant.
+// Role, active flag and audit fields are preserved.
+func (c *HerbalTraceContract) UpdateParticipant(ctx contractapi.TransactionContextInterface, participantID string, participantJSON string) error {
+	participant, err := c.GetParticipant(ctx, participantID)
+	if err != nil {
+		return err
+	}
+
+	var update Participant
+	err = json.Unmarshal([]byte(participantJSON), &update)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal participant JSON: %v", err)
+	}
+
+	if update.Name != "" {
+		participant.Name = update.Name
+	}
+	if update.Organization != "" {
+		if err := validateOrganization(update.Organization); err != nil {
+			return err
+		}
+		participant.Organization = update.Organization
+	}
+	if update.Region != "" {
+		participant.Region = update.Region
+	}
+	if update.KYCReference != "" {
+		participant.KYCReference = update.KYCReference
+	}
+	if update.KYCStatus != "" {
+		if err := validateKYCStatus(update.KYCStatus); err != nil {
+			return err
+		}
+		participant.KYCStatus = update.KYCStatus
+	}
+	if update.SignaturePolicy != "" {
+		if err := validateSignaturePolicy(update.SignaturePolicy); err != nil {
+			return err
+		}
+		participant.SignaturePolicy = update.SignaturePolicy
+	}
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+	participant.UpdatedAt = txTime.Format(time.RFC3339)
+
+	if err := c.putParticipant(ctx, participant); err != nil {
+		return err
+	}
+
+	// Emit event
+	eventPayload := map[string]interface{}{
+		"eventType":     "ParticipantUpdated",
+		"participantId": participant.ID,
+		"kycStatus":     participant.KYCStatus,
+		"timestamp":     participant.UpdatedAt,
+	}
+	eventBytes, _ := json.Marshal(eventPayload)
+	ctx.GetStub().SetEvent("ParticipantUpdated", eventBytes)
+
+	return nil
+}
+
+// SuspendParticipant deactivates a participant so that it can no longer record supply chain events
+func (c *HerbalTraceContract) SuspendParticipant(ctx contractapi.TransactionContextInterface, participantID string, reason string) error {
+	if reason == "" {
+		return fmt.Errorf("reason is required")
+	}
+
+	return c.setParticipantActive(ctx, participantID, false, reason)
+}
+
+// ReactivateParticipant re-enables a suspended participant
+func (c *HerbalTraceContract) ReactivateParticipant(ctx contractapi.TransactionContextInterface, participantID string) error {
+	return c.setParticipantActive(ctx, participantID, true, "")
+}
+
+// GetParticipant retrieves a participant by ID
+func (c *HerbalTraceContract) GetParticipant(ctx contractapi.TransactionContextInterface, participantID string) (*Participant, error) {
+	if participantID == "" {
+		return nil, fmt.Errorf("participant ID is required")
+	}
+
+	participantBytes, err := ctx.GetStub().GetState(participantKey(participantID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read participant from ledger: %v", err)
+	}
+	if participantBytes == nil {
+		return nil, fmt.Errorf("participant with ID %s does not exist", participantID)
+	}
+
+	var participant Participant
+	err = json.Unmarshal(participantBytes, &participant)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal participant: %v", err)
+	}
+
+	return &participant, nil
+}
+
+// QueryParticipantsByRole retrieves all participants with a specific role
+func (c *HerbalTraceContract) QueryParticipantsByRole(ctx contractapi.TransactionContextInterface, role string) ([]*Participant, error) {
+	if err := validateParticipantRole(role); err != nil {
+		return nil, err
+	}
+
+	queryString := fmt.Sprintf(`{
+		"selector": {
+			"type": "Participant",
+			"role": "%s"
+		}
+	}`, role)
+
+	resultsIterator, err := ctx.GetStub().GetQueryResult(queryString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query participants: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	var participants []*Participant
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate query results: %v", err)
+		}
+
+		var participant Participant
+		err = json.Unmarshal(queryResponse.Value, &participant)
+		if err != nil {
+			continue
+		}
+		participants = append(participants, &participant)
+	}
+
+	return participants, nil
+}
+
+// setParticipantActive flips the active flag of a participant and emits the matching event
+func (c *HerbalTraceContract) setParticipantActive(ctx contractapi.TransactionContextInterface, participantID string, active bool, reason string) error {
+	participant, err := c.GetParticipant(ctx, participantID)
+	if err != nil {
+		return err
+	}
+	if participant.Active == active {
+		if active {
+			return fmt.Errorf("participant %s is already active", participantID)
+		}
+		return fmt.Errorf("participant %s is already suspended", participantID)
+	}
+
+	participant.Active = active
+	participant.SuspendedReason = reason
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+	participant.UpdatedAt = txTime.Format(time.RFC3339)
+
+	if err := c.putParticipant(ctx, participant); err != nil {
+		return err
+	}
+
+	eventName := "ParticipantReactivated"
+	if !active {
+		eventName = "ParticipantSuspended"
+	}
+	eventPayload := map[string]interface{}{
+		"eventType":     eventName,
+		"participantId": participant.ID,
+		"reason":        reason,
+		"timestamp":     participant.UpdatedAt,
+	}
+	eventBytes, _ := json.Marshal(eventPayload)
+	ctx.GetStub().SetEvent(eventName, eventBytes)
+
+	return nil
+}
+
+// putParticipant saves a participant to the ledger
+func (c *HerbalTraceContract) putParticipant(ctx contractapi.TransactionContextInterface, participant *Participant) error {
+	participantBytes, err := json.Marshal(participant)
+	if err != nil {
+		return fmt.Errorf("failed to marshal participant: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(participantKey(participant.ID), participantBytes)
+	if err != nil {
+		return fmt.Errorf("failed to save participant to ledger: %v", err)
+	}
+
+	return nil
+}
+
+// requireActiveParticipant checks that a participant is registered with the expected role and
+// is not suspended, and that farmers have passed KYC. Non-admin submitters must belong to the
+// participant's organization, and submitters holding the participant's role must act for that
+// participant (see getClientIdentity), so that one lab cannot record results as another.
+func (c *HerbalTraceContract) requireActiveParticipant(ctx contractapi.TransactionContextInterface, participantID string, role string) (*Participant, error) {
+	if participantID == "" {
+		return nil, fmt.Errorf("%s ID is required", role)
+	}
+
+	participant, err := c.GetParticipant(ctx, participantID)
+	if err != nil {
+		return nil, fmt.Errorf("unknown %s: %s", role, participantID)
+	}
+	if participant.Role != role {
+		return nil, fmt.Errorf("participant %s is registered as %s, not %s", participantID, participant.Role, role)
+	}
+	if !participant.Active {
+		return nil, fmt.Errorf("%s %s is suspended: %s", role, participantID, participant.SuspendedReason)
+	}
+	if role == RoleFarmer && participant.KYCStatus != "verified" {
+		return nil, fmt.Errorf("%s %s has not passed KYC (status %s)", role, participantID, participant.KYCStatus)
+	}
+
+	identity, err := getClientIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if identity.Role == RoleAdmin {
+		return participant, nil
+	}
+	if identity.MSPID != participant.Organization {
+		return nil, fmt.Errorf("access denied: %s %s belongs to %s, not %s", role, participantID, participant.Organization, identity.MSPID)
+	}
+	if identity.Role == role && identity.ParticipantID != participant.ID {
+		return nil, fmt.Errorf("access denied: %s (%s) acts for participant %s, not %s %s",
+			identity.EnrollmentID, identity.MSPID, identity.ParticipantID, role, participantID)
+	}
+
+	return participant, nil
+}
+
+// validateParticipantRole checks that a role can be held by a registered participant
+func validateParticipantRole(role string) error {
+	switch role {
+	case RoleFarmer, RoleLab, RoleProcessor, RoleManufacturer:
+		return nil
+	}
+	return fmt.Errorf("invalid participant role: %s. Valid roles: farmer, lab, processor, manufacturer", role)
+}
+
+// validateKYCStatus checks a participant verification status
+func validateKYCStatus(status string) error {
+	switch status {
+	case "pending", "verified", "rejected":
+		return nil
+	}
+	return fmt.Errorf("invalid KYC status: %s. Valid statuses: pending, verified, rejected", status)
+}
+
+// validateOrganization checks that an organization is one of the network's MSPs
+func validateOrganization(organization string) error {
+	if organization == "" {
+		return fmt.Errorf("organization is required")
+	}
+	if _, known := mspRoles[organization]; !known {
+		return fmt.Errorf("unknown organization %s; it must be the MSP ID of a network member", organization)
+	}
+	return nil
+}
+
+// validateSignaturePolicy checks how a lab handles missing or invalid tester signatures
+func validateSignaturePolicy(policy string) error {
+	switch policy {
+	case "", "reject", "flag":
+		return nil
+	}
+	return fmt.Errorf("invalid signature policy: %s. Valid policies: reject, flag", policy)
+}
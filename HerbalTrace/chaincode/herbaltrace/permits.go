@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// HarvestPermit is a special permit, typically issued by a state forest department, allowing a
+// farmer to harvest a restricted species in a zone up to a fixed quantity
+type HarvestPermit struct {
+	ID                string  `json:"id"`
+	Type              string  `json:"type"` // "HarvestPermit"
+	PermitNumber      string  `json:"permitNumber"`
+	Issuer            string  `json:"issuer"`   // Issuing authority, e.g. "Uttarakhand Forest Department"
+	HolderID          string  `json:"holderId"` // Farmer participant ID
+	Species           string  `json:"species"`
+	ZoneID            string  `json:"zoneId,omitempty"` // Approved zone; empty = any approved zone
+	ValidFrom         string  `json:"validFrom"`
+	ValidUntil        string  `json:"validUntil"`
+	PermittedQuantity float64 `json:"permittedQuantity"`
+	RemainingQuantity float64 `json:"remainingQuantity"`
+	Unit              string  `json:"unit"`
+	Status            string  `json:"status"` // "active", "exhausted", "revoked"
+	RevokedReason     string  `json:"revokedReason,omitempty"`
+	RecordedBy        string  `json:"recordedBy"`
+	CreatedAt         string  `json:"createdAt"`
+	UpdatedAt         string  `json:"updatedAt"`
+}
+
+// harvestPermitKey returns the ledger key for a harvest permit ID
+func harvestPermitKey(permitID string) string {
+	return "permit_" + permitID
+}
+
+// RegisterHarvestPermit records a harvest permit issued to a farmer
+func (c *HerbalTraceContract) RegisterHarvestPermit(ctx contractapi.TransactionContextInterface, permitJSON string) error {
+	var permit HarvestPermit
+	err := json.Unmarshal([]byte(permitJSON), &permit)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal harvest permit JSON: %v", err)
+	}
+
+	// Validate required fields
+	if permit.ID == "" {
+		return fmt.Errorf("permit ID is required")
+	}
+	if permit.PermitNumber == "" || permit.Issuer == "" {
+		return fmt.Errorf("permit number and issuer are required")
+	}
+	if _, err := c.requireActiveParticipant(ctx, permit.HolderID, RoleFarmer); err != nil {
+		return err
+	}
+	permit.Species, err = c.normalizeSpecies(ctx, permit.Species)
+	if err != nil {
+		return err
+	}
+	if permit.ZoneID != "" {
+		if _, err := c.GetApprovedZone(ctx, permit.ZoneID); err != nil {
+			return err
+		}
+	}
+	validFrom, err := parseLedgerDate(permit.ValidFrom)
+	if err != nil {
+		return fmt.Errorf("invalid valid from date: %v", err)
+	}
+	validUntil, err := parseLedgerDate(permit.ValidUntil)
+	if err != nil {
+		return fmt.Errorf("invalid valid until date: %v", err)
+	}
+	if validUntil.Before(validFrom) {
+		return fmt.Errorf("permit validity ends before it starts")
+	}
+	if permit.PermittedQuantity <= 0 {
+		return fmt.Errorf("permitted quantity must be greater than zero")
+	}
+	if permit.Unit == "" {
+		return fmt.Errorf("unit is required")
+	}
+	if _, err := lookupUnit(permit.Unit); err != nil {
+		return err
+	}
+
+	existing, err := ctx.GetStub().GetState(harvestPermitKey(permit.ID))
+	if err != nil {
+		return fmt.Errorf("failed to check if harvest permit exists: %v", err)
+	}
+	if existing != nil {
+		return fmt.Errorf("harvest permit %s already exists", permit.ID)
+	}
+
+	identity, err := getClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	permit.Type = "HarvestPermit"
+	permit.RemainingQuantity = permit.PermittedQuantity
+	permit.Status = "active"
+	permit.RevokedReason = ""
+	permit.RecordedBy = identity.EnrollmentID
+	permit.CreatedAt = txTime.Format(time.RFC3339)
+	permit.UpdatedAt = permit.CreatedAt
+
+	if err := c.putHarvestPermit(ctx, &permit); err != nil {
+		return err
+	}
+
+	// Emit event
+	eventPayload := map[string]interface{}{
+		"eventType":         "HarvestPermitRegistered",
+		"permitId":          permit.ID,
+		"holderId":          permit.HolderID,
+		"species":           permit.Species,
+		"permittedQuantity": permit.PermittedQuantity,
+		"unit":              permit.Unit,
+		"validUntil":        permit.ValidUntil,
+		"timestamp":         permit.CreatedAt,
+	}
+	eventBytes, _ := json.Marshal(eventPayload)
+	ctx.GetStub().SetEvent("HarvestPermitRegistered", eventBytes)
+
+	return nil
+}
+
+// RevokeHarvestPermit revokes a harvest permit so that no further harvests can be recorded against it
+func (c *HerbalTraceContract) RevokeHarvestPermit(ctx contractapi.TransactionContextInterface, permitID string, reason string) error {
+	if reason == "" {
+		return fmt.Errorf("a reason is required to revoke a harvest permit")
+	}
+
+	permit, err := c.GetHarvestPermit(ctx, permitID)
+	if err != nil {
+		return err
+	}
+	if permit.Status == "revoked" {
+		return fmt.Errorf("harvest permit %s is already revoked", permitID)
+	}
+
+	permit.Status = "revoked"
+	permit.RevokedReason = reason
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+	permit.UpdatedAt = txTime.Format(time.RFC3339)
+
+	return c.putHarvestPermit(ctx, permit)
+}
+
+// GetHarvestPermit retrieves a harvest permit by ID
+func (c *HerbalTraceContract) GetHarvestPermit(ctx contractapi.TransactionContextInterface, permitID string) (*HarvestPermit, error) {
+	permitBytes, err := ctx.GetStub().GetState(harvestPermitKey(permitID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read harvest permit: %v", err)
+	}
+	if permitBytes == nil {
+		return nil, fmt.Errorf("harvest permit %s does not exist", permitID)
+	}
+
+	var permit HarvestPermit
+	err = json.Unmarshal(permitBytes, &permit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal harvest permit: %v", err)
+	}
+
+	return &permit, nil
+}
+
+// QueryHarvestPermitsByHolder retrieves all harvest permits issued to a farmer
+func (c *HerbalTraceContract) QueryHarvestPermitsByHolder(ctx contractapi.TransactionContextInterface, holderID string) ([]*HarvestPermit, error) {
+	queryString := fmt.Sprintf(`{"selector":{"type":"HarvestPermit","holderId":"%s"}}`, holderID)
+
+	resultsIterator, err := ctx.GetStub().GetQueryResult(queryString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query harvest permits: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	var permits []*HarvestPermit
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var permit HarvestPermit
+		err = json.Unmarshal(queryResponse.Value, &permit)
+		if err != nil {
+			return nil, err
+		}
+		permits = append(permits, &permit)
+	}
+
+	return permits, nil
+}
+
+// debitHarvestPermit checks the permit referenced by a collection event and debits the harvested
+// quantity from it. The debited permit is returned unsaved, so that it is only written once every
+// other check of the event has passed. It returns a non-empty refusal when the permit does not exist,
+// does not cover the harvest, has expired (on the harvest date or at the transaction time) or would be
+// overdrawn.
+func (c *HerbalTraceContract) debitHarvestPermit(ctx contractapi.TransactionContextInterface, event *CollectionEvent) (*HarvestPermit, string, error) {
+	permitBytes, err := ctx.GetStub().GetState(harvestPermitKey(event.PermitID))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read harvest permit: %v", err)
+	}
+	if permitBytes == nil {
+		return nil, fmt.Sprintf("harvest permit %s does not exist", event.PermitID), nil
+	}
+	var permit HarvestPermit
+	err = json.Unmarshal(permitBytes, &permit)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to unmarshal harvest permit: %v", err)
+	}
+
+	if permit.Status == "revoked" {
+		return nil, fmt.Sprintf("harvest permit %s was revoked: %s", permit.ID, permit.RevokedReason), nil
+	}
+	if permit.HolderID != event.FarmerID {
+		return nil, fmt.Sprintf("harvest permit %s is not held by farmer %s", permit.ID, event.FarmerID), nil
+	}
+	if permit.Species != event.Species {
+		return nil, fmt.Sprintf("harvest permit %s does not cover species %s", permit.ID, event.Species), nil
+	}
+	if permit.ZoneID != "" && permit.ZoneID != event.ApprovedZoneID {
+		return nil, fmt.Sprintf("harvest permit %s does not cover zone %s", permit.ID, event.ZoneName), nil
+	}
+	quantity, err := convertQuantity(event.CanonicalQuantity, event.CanonicalUnit, permit.Unit)
+	if err != nil {
+		return nil, fmt.Sprintf("harvest permit %s: %v", permit.ID, err), nil
+	}
+
+	harvestDate, err := parseLedgerDate(event.HarvestDate)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid harvest date: %v", err)
+	}
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	validFrom, _ := parseLedgerDate(permit.ValidFrom)
+	validUntil, _ := parseLedgerDate(permit.ValidUntil)
+	if harvestDate.Before(validFrom) {
+		return nil, fmt.Sprintf("permit %s is not valid until %s", permit.ID, permit.ValidFrom), nil
+	}
+	// A date-only ValidUntil covers the whole day
+	if len(permit.ValidUntil) == len("2006-01-02") {
+		validUntil = validUntil.AddDate(0, 0, 1)
+	}
+	// The harvest date is chosen by the client, so the permit must also still be valid at submission
+	if !harvestDate.Before(validUntil) || !txTime.Before(validUntil) {
+		return nil, fmt.Sprintf("permit %s expired on %s", permit.ID, permit.ValidUntil), nil
+	}
+	if permit.Status == "exhausted" || quantity > permit.RemainingQuantity {
+		return nil, fmt.Sprintf("permit %s has %.2f %s remaining, %.2f %s requested",
+			permit.ID, permit.RemainingQuantity, permit.Unit, quantity, permit.Unit), nil
+	}
+
+	permit.RemainingQuantity = roundQuantity(permit.RemainingQuantity - quantity)
+	if permit.RemainingQuantity <= 0 {
+		permit.RemainingQuantity = 0
+		permit.Status = "exhausted"
+	}
+	permit.UpdatedAt = txTime.Format(time.RFC3339)
+
+	return &permit, "", nil
+}
+
+// putHarvestPermit writes a harvest permit to the ledger
+func (c *HerbalTraceContract) putHarvestPermit(ctx contractapi.TransactionContextInterface, permit *HarvestPermit) error {
+	permitBytes, err := json.Marshal(permit)
+	if err != nil {
+		return fmt.Errorf("failed to marshal harvest permit: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(harvestPermitKey(permit.ID), permitBytes)
+	if err != nil {
+		return fmt.Errorf("failed to save harvest permit: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Private data collections (see collections_config.json)
+const (
+	farmerPrivateCollection = "farmerPrivateDetails"
+
+	// farmerPrivateCollectionOrg is the only member of the farmer private data collection; peers of
+	// other organizations never hold the private details
+	farmerPrivateCollectionOrg = "FarmersCoopMSP"
+
+	// collectionPrivateTransientKey is the transient map key carrying CollectionEventPrivateDetails
+	collectionPrivateTransientKey = "collectionPrivate"
+
+	// minPrivateSaltLength keeps salted hashes of coordinates from being brute-forced
+	minPrivateSaltLength = 16
+)
+
+// CollectionEventPrivateDetails holds the farmer PII and exact coordinates of a collection event.
+// It is stored only in the farmer private data collection; the public event keeps its salted hash.
+type CollectionEventPrivateDetails struct {
+	EventID    string  `json:"eventId"`
+	FarmerID   string  `json:"farmerId"`
+	FarmerName string  `json:"farmerName"`
+	Latitude   float64 `json:"latitude"`
+	Longitude  float64 `json:"longitude"`
+	Salt       string  `json:"salt"` // Client-generated random salt
+}
+
+// readCollectionPrivateDetails reads the private details of a collection event from the transient map
+// and copies them onto the event so that validation can use the exact coordinates
+func readCollectionPrivateDetails(ctx contractapi.TransactionContextInterface, event *CollectionEvent) (*CollectionEventPrivateDetails, error) {
+	if event.FarmerName != "" || event.Latitude != 0 || event.Longitude != 0 {
+		return nil, fmt.Errorf("farmer name and coordinates must be submitted in the %s transient field, not the public event", collectionPrivateTransientKey)
+	}
+
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transient data: %v", err)
+	}
+	privateJSON, ok := transientMap[collectionPrivateTransientKey]
+	if !ok || len(privateJSON) == 0 {
+		return nil, fmt.Errorf("private details are required in the %s transient field", collectionPrivateTransientKey)
+	}
+
+	var details CollectionEventPrivateDetails
+	err = json.Unmarshal(privateJSON, &details)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal private details: %v", err)
+	}
+	if len(details.Salt) < minPrivateSaltLength {
+		return nil, fmt.Errorf("private details salt must be at least %d characters", minPrivateSaltLength)
+	}
+	details.EventID = event.ID
+	details.FarmerID = event.FarmerID
+	event.FarmerName = details.FarmerName
+	event.Latitude = details.Latitude
+	event.Longitude = details.Longitude
+
+	return &details, nil
+}
+
+// privateDataHash returns the hex SHA-256 hash Fabric records on the ledger for a private data value
+func privateDataHash(value []byte) string {
+	hash := sha256.Sum256(value)
+	return hex.EncodeToString(hash[:])
+}
+
+// putCollectionPrivateDetails stores the private details of a collection event, removes them from the
+// public event and records their salted hash on it
+func putCollectionPrivateDetails(ctx contractapi.TransactionContextInterface, event *CollectionEvent, details *CollectionEventPrivateDetails) error {
+	detailsBytes, err := json.Marshal(details)
+	if err != nil {
+		return fmt.Errorf("failed to marshal private details: %v", err)
+	}
+
+	err = ctx.GetStub().PutPrivateData(farmerPrivateCollection, event.ID, detailsBytes)
+	if err != nil {
+		return fmt.Errorf("failed to save private details: %v", err)
+	}
+
+	event.PrivateDataHash = privateDataHash(detailsBytes)
+	event.FarmerName = ""
+	event.Latitude = 0
+	event.Longitude = 0
+
+	return nil
+}
+
+// GetCollectionEventPrivateDetails retrieves the farmer PII and exact coordinates of a collection event.
+// Farmers may only read their own events; admins and regulators of the farmer cooperative, the
+// collection's only member, may read any event.
+func (c *HerbalTraceContract) GetCollectionEventPrivateDetails(ctx contractapi.TransactionContextInterface, eventID string) (*CollectionEventPrivateDetails, error) {
+	event, err := c.GetCollectionEvent(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	identity, err := getClientIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if identity.MSPID != farmerPrivateCollectionOrg {
+		return nil, fmt.Errorf("access denied: private details are only readable by members of %s", farmerPrivateCollectionOrg)
+	}
+	if identity.Role == RoleFarmer && identity.EnrollmentID != event.FarmerID {
+		return nil, fmt.Errorf("access denied: farmer %s may not read private details of event %s", identity.EnrollmentID, eventID)
+	}
+	if event.PrivateDataErasedAt != "" {
+		return nil, fmt.Errorf("private details of event %s were erased at %s", eventID, event.PrivateDataErasedAt)
+	}
+
+	detailsBytes, err := ctx.GetStub().GetPrivateData(farmerPrivateCollection, eventID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private details: %v", err)
+	}
+	if detailsBytes == nil {
+		return nil, fmt.Errorf("private details for event %s are not available on this peer", eventID)
+	}
+
+	var details CollectionEventPrivateDetails
+	err = json.Unmarshal(detailsBytes, &details)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal private details: %v", err)
+	}
+
+	return &details, nil
+}
+
+// VerifyCollectionEventPrivateData checks that private details supplied by an auditor match the salted
+// hash on the public collection event and the hash of the private data committed to the ledger
+func (c *HerbalTraceContract) VerifyCollectionEventPrivateData(ctx contractapi.TransactionContextInterface, eventID string, privateJSON string) (bool, error) {
+	event, err := c.GetCollectionEvent(ctx, eventID)
+	if err != nil {
+		return false, err
+	}
+	if event.PrivateDataHash == "" {
+		return false, fmt.Errorf("event %s has no private data hash", eventID)
+	}
+
+	var details CollectionEventPrivateDetails
+	err = json.Unmarshal([]byte(privateJSON), &details)
+	if err != nil {
+		return false, fmt.Errorf("failed to unmarshal private details: %v", err)
+	}
+
+	// Re-serialize in canonical field order before hashing
+	detailsBytes, err := json.Marshal(details)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal private details: %v", err)
+	}
+	if privateDataHash(detailsBytes) != event.PrivateDataHash {
+		return false, nil
+	}
+
+	// The committed private data hash is visible to every peer, including non-members
+	ledgerHash, err := ctx.GetStub().GetPrivateDataHash(farmerPrivateCollection, eventID)
+	if err != nil {
+		return false, fmt.Errorf("failed to read private data hash: %v", err)
+	}
+	if ledgerHash == nil {
+		// Private data was purged; the public hash remains the proof
+		return true, nil
+	}
+
+	return hex.EncodeToString(ledgerHash) == event.PrivateDataHash, nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// allZones is the zone of a harvest quota that applies across every zone
+const allZones = "*"
+
+// HarvestAllowance reports how much of a harvest limit or quota is left
+type HarvestAllowance struct {
+	LimitID     string  `json:"limitId"`
+	Scope       string  `json:"scope"` // "farmer", "cooperative"
+	Species     string  `json:"species"`
+	Zone        string  `json:"zone"`
+	Season      string  `json:"season"`
+	MaxQuantity float64 `json:"maxQuantity"`
+	Used        float64 `json:"used"`
+	Remaining   float64 `json:"remaining"`
+	Unit        string  `json:"unit"`
+}
+
+// harvestLimitKey returns the ledger key for the zone harvest limit of a species in a season
+func harvestLimitKey(species string, zone string, season string) string {
+	return fmt.Sprintf("limit_%s_%s_%s",
+		strings.ReplaceAll(species, " ", "_"),
+		strings.ReplaceAll(zone, " ", "_"),
+		strings.ReplaceAll(season, " ", "_"))
+}
+
+// harvestQuotaKey returns the ledger key for a per-farmer or per-cooperative harvest quota
+func harvestQuotaKey(species string, zone string, season string, scope string, holder string) string {
+	return fmt.Sprintf("%s_%s_%s", harvestLimitKey(species, zone, season), scope, strings.ReplaceAll(holder, " ", "_"))
+}
+
+// quotaScope returns the scope of a harvest limit: "zone", "farmer" or "cooperative"
+func (l *HarvestLimit) quotaScope() string {
+	if l.FarmerID != "" {
+		return "farmer"
+	}
+	if l.Cooperative != "" {
+		return "cooperative"
+	}
+	return "zone"
+}
+
+// GetFarmerAllowance lists a farmer's remaining allowance under every farmer and cooperative quota
+// that applies to them, across all zones. An empty season returns every season.
+func (c *HerbalTraceContract) GetFarmerAllowance(ctx contractapi.TransactionContextInterface, farmerID string, season string) ([]*HarvestAllowance, error) {
+	identity, err := getClientIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if identity.Role == RoleFarmer && identity.EnrollmentID != farmerID {
+		return nil, fmt.Errorf("access denied: farmer %s may only query their own allowance", identity.EnrollmentID)
+	}
+
+	farmer, err := c.GetParticipant(ctx, farmerID)
+	if err != nil {
+		return nil, err
+	}
+
+	seasonSelector := ""
+	if season != "" {
+		seasonSelector = fmt.Sprintf(`,"season":"%s"`, season)
+	}
+	queryString := fmt.Sprintf(`{"selector":{"type":"HarvestLimit","$or":[{"farmerId":"%s"},{"cooperative":"%s"}]%s}}`,
+		farmerID, farmer.Organization, seasonSelector)
+
+	resultsIterator, err := ctx.GetStub().GetQueryResult(queryString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query harvest quotas: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	allowances := []*HarvestAllowance{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var limit HarvestLimit
+		err = json.Unmarshal(queryResponse.Value, &limit)
+		if err != nil {
+			return nil, err
+		}
+
+		remaining := limit.MaxQuantity - limit.CurrentQuantity
+		if remaining < 0 {
+			remaining = 0
+		}
+		allowances = append(allowances, &HarvestAllowance{
+			LimitID:     limit.ID,
+			Scope:       limit.quotaScope(),
+			Species:     limit.Species,
+			Zone:        limit.Zone,
+			Season:      limit.Season,
+			MaxQuantity: limit.MaxQuantity,
+			Used:        limit.CurrentQuantity,
+			Remaining:   remaining,
+			Unit:        limit.Unit,
+		})
+	}
+
+	return allowances, nil
+}
+
+// applicableQuotas reads the farmer and cooperative quotas that apply to a harvest, for the zone
+// itself and across all zones
+func (c *HerbalTraceContract) applicableQuotas(ctx contractapi.TransactionContextInterface, species string, zone string, season string, farmer *Participant) ([]*HarvestLimit, error) {
+	var quotas []*HarvestLimit
+	for _, quotaZone := range []string{zone, allZones} {
+		for _, key := range []string{
+			harvestQuotaKey(species, quotaZone, season, "farmer", farmer.ID),
+			harvestQuotaKey(species, quotaZone, season, "cooperative", farmer.Organization),
+		} {
+			quotaBytes, err := ctx.GetStub().GetState(key)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read harvest quota: %v", err)
+			}
+			if quotaBytes == nil {
+				continue
+			}
+
+			var quota HarvestLimit
+			err = json.Unmarshal(quotaBytes, &quota)
+			if err != nil {
+				return nil, fmt.Errorf("failed to unmarshal harvest quota: %v", err)
+			}
+			quotas = append(quotas, &quota)
+		}
+	}
+
+	return quotas, nil
+}
+
+// checkHarvestQuotas returns the first quota the harvest would exceed, or nil. Quantities in a unit
+// that cannot be converted to a quota's unit are refused with the reason.
+func checkHarvestQuotas(quotas []*HarvestLimit, quantity float64, unit string) (*HarvestLimit, string) {
+	for _, quota := range quotas {
+		quotaQuantity, err := convertQuantity(quantity, unit, quota.Unit)
+		if err != nil {
+			return nil, fmt.Sprintf("harvest quota %s: %v", quota.ID, err)
+		}
+		if quota.CurrentQuantity+quotaQuantity > quota.MaxQuantity {
+			return quota, ""
+		}
+	}
+	return nil, ""
+}
+
+// trackHarvestQuotas adds a harvested quantity to each quota and updates its status
+func (c *HerbalTraceContract) trackHarvestQuotas(ctx contractapi.TransactionContextInterface, quotas []*HarvestLimit, quantity float64, unit string) error {
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+	for _, quota := range quotas {
+		quotaQuantity, err := convertQuantity(quantity, unit, quota.Unit)
+		if err != nil {
+			return fmt.Errorf("harvest quota %s: %v", quota.ID, err)
+		}
+		quota.CurrentQuantity = roundQuantity(quota.CurrentQuantity + quotaQuantity)
+		quota.UpdatedAt = txTime.Format(time.RFC3339)
+
+		percentageUsed := (quota.CurrentQuantity / quota.MaxQuantity) * 100
+		if percentageUsed >= 100 {
+			quota.Status = "exceeded"
+		} else if percentageUsed >= quota.AlertThreshold {
+			quota.Status = "warning"
+		} else {
+			quota.Status = "normal"
+		}
+
+		quotaBytes, err := json.Marshal(quota)
+		if err != nil {
+			return fmt.Errorf("failed to marshal harvest quota: %v", err)
+		}
+		err = ctx.GetStub().PutState(quota.ID, quotaBytes)
+		if err != nil {
+			return fmt.Errorf("failed to update harvest quota: %v", err)
+		}
+	}
+
+	return nil
+}
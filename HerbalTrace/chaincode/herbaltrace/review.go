@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// CollectionEventReview records a supervisor's decision on a collection event, typically after a
+// physical spot check. Reviews are kept on the event in the order they were made.
+type CollectionEventReview struct {
+	Decision     string   `json:"decision"`   // "verified", "rejected"
+	FromStatus   string   `json:"fromStatus"` // Event status before the decision
+	Reason       string   `json:"reason"`
+	EvidenceRefs []string `json:"evidenceRefs,omitempty"` // Photos, documents or IPFS hashes from the check
+	CheckDate    string   `json:"checkDate,omitempty"`    // Date of the physical spot check
+	ReviewedBy   string   `json:"reviewedBy"`
+	ReviewerMSP  string   `json:"reviewerMsp"`
+	ReviewerRole string   `json:"reviewerRole"`
+	ReviewedAt   string   `json:"reviewedAt"`
+	TxID         string   `json:"txId"`
+}
+
+// VerifyCollectionEvent marks a pending collection event as verified so that it can be batched
+func (c *HerbalTraceContract) VerifyCollectionEvent(ctx contractapi.TransactionContextInterface, eventID string, reviewJSON string) error {
+	return c.reviewCollectionEvent(ctx, eventID, reviewJSON, "verified")
+}
+
+// RejectCollectionEvent marks a collection event as rejected. Verified events can still be rejected
+// until they are batched. Quantities already tracked against harvest limits and quotas are not released;
+// events held for review are only tracked once verified.
+func (c *HerbalTraceContract) RejectCollectionEvent(ctx contractapi.TransactionContextInterface, eventID string, reviewJSON string) error {
+	return c.reviewCollectionEvent(ctx, eventID, reviewJSON, "rejected")
+}
+
+// reviewCollectionEvent applies a supervisor decision to a collection event and appends it to the
+// event's review history
+func (c *HerbalTraceContract) reviewCollectionEvent(ctx contractapi.TransactionContextInterface, eventID string, reviewJSON string, decision string) error {
+	var review CollectionEventReview
+	err := json.Unmarshal([]byte(reviewJSON), &review)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal review JSON: %v", err)
+	}
+	if decision == "rejected" && review.Reason == "" {
+		return fmt.Errorf("a reason is required to reject a collection event")
+	}
+	if review.CheckDate != "" {
+		if _, err := parseLedgerDate(review.CheckDate); err != nil {
+			return fmt.Errorf("invalid check date: %v", err)
+		}
+	}
+
+	event, err := c.GetCollectionEvent(ctx, eventID)
+	if err != nil {
+		return err
+	}
+	if event.Type != "CollectionEvent" {
+		return fmt.Errorf("%s is not a collection event", eventID)
+	}
+	switch {
+	case event.BatchID != "":
+		return fmt.Errorf("collection event %s is already in batch %s", eventID, event.BatchID)
+	case event.Status == decision:
+		return fmt.Errorf("collection event %s is already %s", eventID, decision)
+	case event.Status == "rejected":
+		return fmt.Errorf("collection event %s was rejected", eventID)
+	case decision == "verified" && event.Status != "pending" && event.Status != "pending_review":
+		return fmt.Errorf("collection event %s is %s and cannot be verified", eventID, event.Status)
+	}
+
+	// Supervisors review the events of their own cooperative; admins and regulators review any event
+	identity, err := getClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+	if identity.Role == RoleSupervisor {
+		farmer, err := c.GetParticipant(ctx, event.FarmerID)
+		if err != nil {
+			return err
+		}
+		if farmer.Organization != identity.MSPID {
+			return fmt.Errorf("access denied: supervisor %s (%s) may not review events of farmers in %s",
+				identity.EnrollmentID, identity.MSPID, farmer.Organization)
+		}
+	}
+
+	// An event held for review uses harvest limits, quotas and permits only once verified
+	if decision == "verified" && event.Status == "pending_review" {
+		if err := c.applyReviewedCollectionEvent(ctx, event); err != nil {
+			return err
+		}
+	}
+
+	review.Decision = decision
+	review.FromStatus = event.Status
+	review.ReviewedBy = identity.EnrollmentID
+	review.ReviewerMSP = identity.MSPID
+	review.ReviewerRole = identity.Role
+	review.ReviewedAt = txTime.Format(time.RFC3339)
+	review.TxID = ctx.GetStub().GetTxID()
+
+	event.Status = decision
+	event.Reviews = append(event.Reviews, review)
+	if err := c.putCollectionEvent(ctx, event); err != nil {
+		return err
+	}
+
+	// Emit event
+	eventName := "CollectionEventVerified"
+	if decision == "rejected" {
+		eventName = "CollectionEventRejected"
+	}
+	eventPayload := map[string]interface{}{
+		"eventType":  eventName,
+		"eventId":    event.ID,
+		"farmerId":   event.FarmerID,
+		"fromStatus": review.FromStatus,
+		"status":     event.Status,
+		"reason":     review.Reason,
+		"evidence":   len(review.EvidenceRefs),
+		"reviewedBy": review.ReviewedBy,
+		"timestamp":  review.ReviewedAt,
+	}
+	eventBytes, _ := json.Marshal(eventPayload)
+	ctx.GetStub().SetEvent(eventName, eventBytes)
+
+	return nil
+}
+
+// GetCollectionEventReviews retrieves the review history of a collection event, oldest first
+func (c *HerbalTraceContract) GetCollectionEventReviews(ctx contractapi.TransactionContextInterface, eventID string) ([]CollectionEventReview, error) {
+	event, err := c.GetCollectionEvent(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+	if event.Reviews == nil {
+		return []CollectionEventReview{}, nil
+	}
+
+	return event.Reviews, nil
+}
+
+// putCollectionEvent writes a collection event to the ledger
+func (c *HerbalTraceContract) putCollectionEvent(ctx contractapi.TransactionContextInterface, event *CollectionEvent) error {
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal collection event: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(event.ID, eventBytes)
+	if err != nil {
+		return fmt.Errorf("failed to save collection event %s: %v", event.ID, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// SeasonCalendar names the harvest seasons of a region. A season is labelled "<year>-<name>",
+// where the year is the year in which the season starts, e.g. "2025-Monsoon" or "2025-Winter"
+// for December 2025 to February 2026. HarvestLimit.Season uses these labels.
+type SeasonCalendar struct {
+	ID        string           `json:"id"`
+	Type      string           `json:"type"` // "SeasonCalendar"
+	Region    string           `json:"region"`
+	Seasons   []CalendarSeason `json:"seasons"`
+	UpdatedBy string           `json:"updatedBy"`
+	UpdatedAt string           `json:"updatedAt"`
+}
+
+// CalendarSeason is a named, recurring date range of a season calendar
+type CalendarSeason struct {
+	Name          string `json:"name"`          // e.g. "Monsoon"
+	StartMonthDay string `json:"startMonthDay"` // "MM-DD"
+	EndMonthDay   string `json:"endMonthDay"`   // "MM-DD", inclusive
+}
+
+// defaultSeasonCalendar applies to regions without a SeasonCalendar
+var defaultSeasonCalendar = SeasonCalendar{
+	Region: allRegions,
+	Seasons: []CalendarSeason{
+		{Name: "Spring", StartMonthDay: "03-01", EndMonthDay: "05-31"},
+		{Name: "Monsoon", StartMonthDay: "06-01", EndMonthDay: "09-30"},
+		{Name: "Post-Monsoon", StartMonthDay: "10-01", EndMonthDay: "11-30"},
+		{Name: "Winter", StartMonthDay: "12-01", EndMonthDay: "02-29"},
+	},
+}
+
+// seasonCalendarKey returns the ledger key for the season calendar of a region
+func seasonCalendarKey(region string) string {
+	return "seasoncalendar_" + region
+}
+
+// SetSeasonCalendar creates or replaces the season calendar of a region ("*" for the default calendar)
+// (governed: applied through ExecuteProposal)
+func (c *HerbalTraceContract) SetSeasonCalendar(ctx contractapi.TransactionContextInterface, calendarJSON string) error {
+	var calendar SeasonCalendar
+	err := json.Unmarshal([]byte(calendarJSON), &calendar)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal season calendar JSON: %v", err)
+	}
+
+	if calendar.Region == "" {
+		return fmt.Errorf("region is required")
+	}
+	if len(calendar.Seasons) == 0 {
+		return fmt.Errorf("at least one season is required")
+	}
+	var names []string
+	for _, season := range calendar.Seasons {
+		if season.Name == "" {
+			return fmt.Errorf("season name is required")
+		}
+		if containsString(names, season.Name) {
+			return fmt.Errorf("season %s is defined more than once", season.Name)
+		}
+		names = append(names, season.Name)
+		if monthDayValue(season.StartMonthDay) == 0 || monthDayValue(season.EndMonthDay) == 0 {
+			return fmt.Errorf("season %s must have start and end dates as MM-DD", season.Name)
+		}
+	}
+
+	identity, err := getClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	calendar.ID = seasonCalendarKey(calendar.Region)
+	calendar.Type = "SeasonCalendar"
+	calendar.UpdatedBy = identity.EnrollmentID
+	calendar.UpdatedAt = txTime.Format(time.RFC3339)
+
+	calendarBytes, err := json.Marshal(calendar)
+	if err != nil {
+		return fmt.Errorf("failed to marshal season calendar: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(calendar.ID, calendarBytes)
+	if err != nil {
+		return fmt.Errorf("failed to save season calendar to ledger: %v", err)
+	}
+
+	// Emit event
+	eventPayload := map[string]interface{}{
+		"eventType": "SeasonCalendarSet",
+		"region":    calendar.Region,
+		"seasons":   names,
+		"timestamp": calendar.UpdatedAt,
+	}
+	eventBytes, _ := json.Marshal(eventPayload)
+	ctx.GetStub().SetEvent("SeasonCalendarSet", eventBytes)
+
+	return nil
+}
+
+// GetSeasonCalendar retrieves the season calendar that applies to a region, falling back to the
+// calendar for every region and then to the built-in default calendar
+func (c *HerbalTraceContract) GetSeasonCalendar(ctx contractapi.TransactionContextInterface, region string) (*SeasonCalendar, error) {
+	for _, candidate := range []string{region, allRegions} {
+		if candidate == "" {
+			continue
+		}
+		calendarBytes, err := ctx.GetStub().GetState(seasonCalendarKey(candidate))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read season calendar: %v", err)
+		}
+		if calendarBytes == nil {
+			continue
+		}
+
+		var calendar SeasonCalendar
+		err = json.Unmarshal(calendarBytes, &calendar)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal season calendar: %v", err)
+		}
+		return &calendar, nil
+	}
+
+	calendar := defaultSeasonCalendar
+	return &calendar, nil
+}
+
+// ResolveSeason returns the season label, e.g. "2025-Monsoon", of a harvest date in a region
+func (c *HerbalTraceContract) ResolveSeason(ctx contractapi.TransactionContextInterface, region string, harvestDate string) (string, error) {
+	date, err := parseLedgerDate(harvestDate)
+	if err != nil {
+		return "", fmt.Errorf("invalid harvest date: %v", err)
+	}
+
+	calendar, err := c.GetSeasonCalendar(ctx, region)
+	if err != nil {
+		return "", err
+	}
+
+	return calendar.seasonOf(date)
+}
+
+// seasonOf returns the label of the calendar season containing a date
+func (cal *SeasonCalendar) seasonOf(date time.Time) (string, error) {
+	current := int(date.Month())*100 + date.Day()
+	for _, season := range cal.Seasons {
+		start := monthDayValue(season.StartMonthDay)
+		end := monthDayValue(season.EndMonthDay)
+		year := date.Year()
+
+		if start <= end {
+			if current < start || current > end {
+				continue
+			}
+		} else {
+			// Season spans the new year; label it with the year it started
+			if current < start && current > end {
+				continue
+			}
+			if current <= end {
+				year--
+			}
+		}
+		return strconv.Itoa(year) + "-" + season.Name, nil
+	}
+
+	return "", fmt.Errorf("no season in the calendar for region %s covers %s", cal.Region, date.Format("2006-01-02"))
+}
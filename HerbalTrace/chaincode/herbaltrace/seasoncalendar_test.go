@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSeasonOf(t *testing.T) {
+	// A calendar with a gap between the end of spring and the start of the autumn harvest
+	gapped := &SeasonCalendar{
+		Region: "Himachal Pradesh",
+		Seasons: []CalendarSeason{
+			{Name: "Spring", StartMonthDay: "03-15", EndMonthDay: "05-15"},
+			{Name: "Autumn", StartMonthDay: "09-01", EndMonthDay: "10-31"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		calendar *SeasonCalendar
+		date     string
+		want     string
+		wantErr  bool
+	}{
+		{"first day of spring", &defaultSeasonCalendar, "2025-03-01", "2025-Spring", false},
+		{"last day of spring", &defaultSeasonCalendar, "2025-05-31", "2025-Spring", false},
+		{"monsoon", &defaultSeasonCalendar, "2025-07-15", "2025-Monsoon", false},
+		{"post-monsoon", &defaultSeasonCalendar, "2025-11-30", "2025-Post-Monsoon", false},
+		{"winter in December", &defaultSeasonCalendar, "2025-12-01", "2025-Winter", false},
+		{"winter in January belongs to the season started in December", &defaultSeasonCalendar, "2026-01-10", "2025-Winter", false},
+		{"winter on a leap day", &defaultSeasonCalendar, "2028-02-29", "2027-Winter", false},
+		{"last day of winter", &defaultSeasonCalendar, "2026-02-28", "2025-Winter", false},
+		{"regional season", gapped, "2025-09-01", "2025-Autumn", false},
+		{"date between regional seasons", gapped, "2025-07-01", "", true},
+		{"date after the last regional season", gapped, "2025-12-25", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			date, err := time.Parse("2006-01-02", tt.date)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := tt.calendar.seasonOf(date)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("seasonOf(%s) error = %v, wantErr %v", tt.date, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("seasonOf(%s) = %q, want %q", tt.date, got, tt.want)
+			}
+		})
+	}
+}
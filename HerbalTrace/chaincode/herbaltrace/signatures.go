@@ -0,0 +1,505 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Signature algorithms accepted for registered signing keys
+const (
+	AlgorithmECDSA   = "ECDSA"   // ASN.1 DER signature over the SHA-256 digest of the payload
+	AlgorithmEd25519 = "Ed25519" // Signature over the raw payload
+)
+
+// SigningKey represents a public key registered for an individual who signs records off-chain
+type SigningKey struct {
+	ID           string `json:"id"`
+	Type         string `json:"type"`               // "SigningKey"
+	OwnerID      string `json:"ownerId"`            // Tester ID or farmer participant ID
+	OwnerRole    string `json:"ownerRole"`          // "tester", "farmer"
+	LabID        string `json:"labId,omitempty"`    // Lab of a tester key
+	DeviceID     string `json:"deviceId,omitempty"` // Mobile device holding a farmer key
+	Algorithm    string `json:"algorithm"`          // "ECDSA", "Ed25519"
+	PublicKey    string `json:"publicKey"`          // PEM-encoded PKIX public key
+	Status       string `json:"status"`             // "active", "revoked"
+	RevokeReason string `json:"revokeReason,omitempty"`
+	CreatedBy    string `json:"createdBy"`
+	CreatedAt    string `json:"createdAt"`
+	UpdatedAt    string `json:"updatedAt"`
+}
+
+// qualityTestSignedPayload is the canonical form of the result fields a tester signs.
+// Field order is fixed and encoding/json sorts map keys, so the serialization is stable.
+type qualityTestSignedPayload struct {
+	ID                string             `json:"id"`
+	CollectionEventID string             `json:"collectionEventId"`
+	BatchID           string             `json:"batchId"`
+	LabID             string             `json:"labId"`
+	TesterID          string             `json:"testerId"`
+	TestDate          string             `json:"testDate"`
+	TestTypes         []string           `json:"testTypes"`
+	Matrix            string             `json:"matrix"`
+	MoistureContent   float64            `json:"moistureContent"`
+	PesticideResults  map[string]string  `json:"pesticideResults"`
+	HeavyMetals       map[string]float64 `json:"heavyMetals"`
+	DNABarcodeMatch   bool               `json:"dnaBarcodeMatch"`
+	DNASequence       string             `json:"dnaSequence"`
+	MicrobialLoad     float64            `json:"microbialLoad"`
+	Aflatoxins        float64            `json:"aflatoxins"`
+	CertificateID     string             `json:"certificateId"`
+}
+
+// collectionEventSignedPayload is the canonical form of the fields a farmer device signs at capture time
+type collectionEventSignedPayload struct {
+	ID            string   `json:"id"`
+	FarmerID      string   `json:"farmerId"`
+	DeviceID      string   `json:"deviceId"`
+	Species       string   `json:"species"`
+	Quantity      float64  `json:"quantity"`
+	Unit          string   `json:"unit"`
+	Latitude      float64  `json:"latitude"`
+	Longitude     float64  `json:"longitude"`
+	Altitude      float64  `json:"altitude"`
+	Accuracy      float64  `json:"accuracy"`
+	HarvestDate   string   `json:"harvestDate"`
+	CapturedAt    string   `json:"capturedAt"`
+	HarvestMethod string   `json:"harvestMethod"`
+	PartCollected string   `json:"partCollected"`
+	Images        []string `json:"images"`
+}
+
+// signingKeyKey returns the ledger key for a signing key ID
+func signingKeyKey(keyID string) string {
+	return "signingkey_" + keyID
+}
+
+// RegisterSigningKey registers a tester public key for a lab or a farmer device key.
+// Farmers may only register their own device keys and lab members only keys of their own lab.
+func (c *HerbalTraceContract) RegisterSigningKey(ctx contractapi.TransactionContextInterface, keyJSON string) error {
+	var key SigningKey
+	err := json.Unmarshal([]byte(keyJSON), &key)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal signing key JSON: %v", err)
+	}
+
+	// Validate required fields
+	if key.ID == "" {
+		return fmt.Errorf("signing key ID is required")
+	}
+	if key.OwnerID == "" {
+		return fmt.Errorf("owner ID is required")
+	}
+	if _, err := parseSigningPublicKey(key.Algorithm, key.PublicKey); err != nil {
+		return err
+	}
+
+	identity, err := getClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	owner, err := c.signingKeyOwner(ctx, &key)
+	if err != nil {
+		return err
+	}
+	if identity.Role != RoleAdmin {
+		if err := checkSigningKeyOwner(identity, &key, owner); err != nil {
+			return err
+		}
+	}
+
+	// Check if signing key already exists
+	existingKey, err := ctx.GetStub().GetState(signingKeyKey(key.ID))
+	if err != nil {
+		return fmt.Errorf("failed to check if signing key exists: %v", err)
+	}
+	if existingKey != nil {
+		return fmt.Errorf("signing key with ID %s already exists", key.ID)
+	}
+
+	// Set default values
+	key.Type = "SigningKey"
+	key.Status = "active"
+	key.RevokeReason = ""
+	key.CreatedBy = identity.EnrollmentID
+	key.CreatedAt = txTime.Format(time.RFC3339)
+	key.UpdatedAt = txTime.Format(time.RFC3339)
+
+	if err := c.putSigningKey(ctx, &key); err != nil {
+		return err
+	}
+
+	// Emit event
+	eventPayload := map[string]interface{}{
+		"eventType": "SigningKeyRegistered",
+		"keyId":     key.ID,
+		"ownerId":   key.OwnerID,
+		"ownerRole": key.OwnerRole,
+		"labId":     key.LabID,
+		"deviceId":  key.DeviceID,
+		"algorithm": key.Algorithm,
+		"timestamp": key.CreatedAt,
+	}
+	eventBytes, _ := json.Marshal(eventPayload)
+	ctx.GetStub().SetEvent("SigningKeyRegistered", eventBytes)
+
+	return nil
+}
+
+// RevokeSigningKey revokes a registered signing key so that new signatures made with it are refused.
+// Admins and regulators may revoke any key; farmers and lab members only keys they may register.
+func (c *HerbalTraceContract) RevokeSigningKey(ctx contractapi.TransactionContextInterface, keyID string, reason string) error {
+	if reason == "" {
+		return fmt.Errorf("reason is required")
+	}
+
+	key, err := c.GetSigningKey(ctx, keyID)
+	if err != nil {
+		return err
+	}
+	if key.Status == "revoked" {
+		return fmt.Errorf("signing key %s is already revoked", keyID)
+	}
+
+	identity, err := getClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+	if identity.Role != RoleAdmin && identity.Role != RoleRegulator {
+		owner, err := c.signingKeyOwner(ctx, key)
+		if err != nil {
+			return err
+		}
+		if err := checkSigningKeyOwner(identity, key, owner); err != nil {
+			return err
+		}
+	}
+
+	key.Status = "revoked"
+	key.RevokeReason = reason
+	key.UpdatedAt = txTime.Format(time.RFC3339)
+
+	if err := c.putSigningKey(ctx, key); err != nil {
+		return err
+	}
+
+	// Emit event
+	eventPayload := map[string]interface{}{
+		"eventType": "SigningKeyRevoked",
+		"keyId":     key.ID,
+		"ownerId":   key.OwnerID,
+		"reason":    reason,
+		"timestamp": key.UpdatedAt,
+	}
+	eventBytes, _ := json.Marshal(eventPayload)
+	ctx.GetStub().SetEvent("SigningKeyRevoked", eventBytes)
+
+	return nil
+}
+
+// GetSigningKey retrieves a signing key by ID
+func (c *HerbalTraceContract) GetSigningKey(ctx contractapi.TransactionContextInterface, keyID string) (*SigningKey, error) {
+	if keyID == "" {
+		return nil, fmt.Errorf("signing key ID is required")
+	}
+
+	keyBytes, err := ctx.GetStub().GetState(signingKeyKey(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key from ledger: %v", err)
+	}
+	if keyBytes == nil {
+		return nil, fmt.Errorf("signing key with ID %s does not exist", keyID)
+	}
+
+	var key SigningKey
+	err = json.Unmarshal(keyBytes, &key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal signing key: %v", err)
+	}
+
+	return &key, nil
+}
+
+// GetQualityTestSigningPayload returns the canonical payload a tester must sign for a quality test
+func (c *HerbalTraceContract) GetQualityTestSigningPayload(ctx contractapi.TransactionContextInterface, testJSON string) (string, error) {
+	var test QualityTest
+	err := json.Unmarshal([]byte(testJSON), &test)
+	if err != nil {
+		return "", fmt.Errorf("failed to unmarshal test: %v", err)
+	}
+
+	payload, err := qualityTestSigningPayload(test)
+	if err != nil {
+		return "", err
+	}
+
+	return string(payload), nil
+}
+
+// GetCollectionEventSigningPayload returns the canonical payload a farmer device must sign for a collection event
+func (c *HerbalTraceContract) GetCollectionEventSigningPayload(ctx contractapi.TransactionContextInterface, eventJSON string) (string, error) {
+	var event CollectionEvent
+	err := json.Unmarshal([]byte(eventJSON), &event)
+	if err != nil {
+		return "", fmt.Errorf("failed to unmarshal event: %v", err)
+	}
+
+	payload, err := collectionEventSigningPayload(event)
+	if err != nil {
+		return "", err
+	}
+
+	return string(payload), nil
+}
+
+// signingKeyOwner returns the participant whose organization controls a signing key:
+// the lab for tester keys and the farmer for farmer device keys
+func (c *HerbalTraceContract) signingKeyOwner(ctx contractapi.TransactionContextInterface, key *SigningKey) (*Participant, error) {
+	switch key.OwnerRole {
+	case "tester":
+		lab, err := c.GetParticipant(ctx, key.LabID)
+		if err != nil {
+			return nil, err
+		}
+		if lab.Role != RoleLab {
+			return nil, fmt.Errorf("participant %s is not a lab", key.LabID)
+		}
+		return lab, nil
+	case RoleFarmer:
+		farmer, err := c.GetParticipant(ctx, key.OwnerID)
+		if err != nil {
+			return nil, err
+		}
+		if farmer.Role != RoleFarmer {
+			return nil, fmt.Errorf("participant %s is not a farmer", key.OwnerID)
+		}
+		return farmer, nil
+	}
+	return nil, fmt.Errorf("invalid owner role: %s. Valid roles: tester, farmer", key.OwnerRole)
+}
+
+// checkSigningKeyOwner checks that a farmer or lab member manages a key they own: a farmer device
+// key of the submitting farmer, or a tester key of the lab the submitter acts for
+func checkSigningKeyOwner(identity *ClientIdentity, key *SigningKey, owner *Participant) error {
+	if identity.MSPID != owner.Organization {
+		return fmt.Errorf("access denied: %s %s belongs to %s, not %s", owner.Role, owner.ID, owner.Organization, identity.MSPID)
+	}
+	switch key.OwnerRole {
+	case RoleFarmer:
+		if identity.Role != RoleFarmer || key.OwnerID != identity.EnrollmentID {
+			return fmt.Errorf("access denied: signing key %s belongs to farmer %s, not %s", key.ID, key.OwnerID, identity.EnrollmentID)
+		}
+	case "tester":
+		if identity.Role != RoleLab || key.LabID != identity.ParticipantID {
+			return fmt.Errorf("access denied: signing key %s belongs to lab %s; %s acts for %s", key.ID, key.LabID, identity.EnrollmentID, identity.ParticipantID)
+		}
+	}
+	return nil
+}
+
+// putSigningKey saves a signing key to the ledger
+func (c *HerbalTraceContract) putSigningKey(ctx contractapi.TransactionContextInterface, key *SigningKey) error {
+	keyBytes, err := json.Marshal(key)
+	if err != nil {
+		return fmt.Errorf("failed to marshal signing key: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(signingKeyKey(key.ID), keyBytes)
+	if err != nil {
+		return fmt.Errorf("failed to save signing key to ledger: %v", err)
+	}
+
+	return nil
+}
+
+// verifyTesterSignature checks the tester signature of a quality test against the registered
+// key of the tester. It returns a description of the problem, or "" when the signature is valid.
+func (c *HerbalTraceContract) verifyTesterSignature(ctx contractapi.TransactionContextInterface, test QualityTest) (string, error) {
+	if test.TesterSignature == "" || test.SigningKeyID == "" {
+		return "missing tester signature or signing key ID", nil
+	}
+
+	key, err := c.GetSigningKey(ctx, test.SigningKeyID)
+	if err != nil {
+		return fmt.Sprintf("unknown signing key %s", test.SigningKeyID), nil
+	}
+	if key.Status != "active" {
+		return fmt.Sprintf("signing key %s is %s", key.ID, key.Status), nil
+	}
+	if key.OwnerRole != "tester" {
+		return fmt.Sprintf("signing key %s is a %s key, not a tester key", key.ID, key.OwnerRole), nil
+	}
+	if key.LabID != test.LabID {
+		return fmt.Sprintf("signing key %s is not registered to lab %s", key.ID, test.LabID), nil
+	}
+	if test.TesterID != "" && key.OwnerID != test.TesterID {
+		return fmt.Sprintf("signing key %s does not belong to tester %s", key.ID, test.TesterID), nil
+	}
+
+	payload, err := qualityTestSigningPayload(test)
+	if err != nil {
+		return "", err
+	}
+	if err := verifySignature(key, payload, test.TesterSignature); err != nil {
+		return err.Error(), nil
+	}
+
+	return "", nil
+}
+
+// verifyFarmerSignature checks the device signature of a collection event against the registered
+// key of the farmer. It returns a description of the problem, or "" when the signature is valid.
+func (c *HerbalTraceContract) verifyFarmerSignature(ctx contractapi.TransactionContextInterface, event CollectionEvent) (string, error) {
+	if event.FarmerSignature == "" || event.SigningKeyID == "" {
+		return "missing farmer signature or signing key ID", nil
+	}
+
+	key, err := c.GetSigningKey(ctx, event.SigningKeyID)
+	if err != nil {
+		return fmt.Sprintf("unknown signing key %s", event.SigningKeyID), nil
+	}
+	if key.Status != "active" {
+		return fmt.Sprintf("signing key %s is %s", key.ID, key.Status), nil
+	}
+	if key.OwnerRole != RoleFarmer || key.OwnerID != event.FarmerID {
+		return fmt.Sprintf("signing key %s does not belong to farmer %s", key.ID, event.FarmerID), nil
+	}
+	if key.DeviceID != "" && key.DeviceID != event.DeviceID {
+		return fmt.Sprintf("signing key %s is not registered to device %s", key.ID, event.DeviceID), nil
+	}
+
+	payload, err := collectionEventSigningPayload(event)
+	if err != nil {
+		return "", err
+	}
+	if err := verifySignature(key, payload, event.FarmerSignature); err != nil {
+		return err.Error(), nil
+	}
+
+	return "", nil
+}
+
+// collectionEventSigningPayload serializes the farmer-signed fields of a collection event
+func collectionEventSigningPayload(event CollectionEvent) ([]byte, error) {
+	payload, err := json.Marshal(collectionEventSignedPayload{
+		ID:            event.ID,
+		FarmerID:      event.FarmerID,
+		DeviceID:      event.DeviceID,
+		Species:       event.Species,
+		Quantity:      event.Quantity,
+		Unit:          event.Unit,
+		Latitude:      event.Latitude,
+		Longitude:     event.Longitude,
+		Altitude:      event.Altitude,
+		Accuracy:      event.Accuracy,
+		HarvestDate:   event.HarvestDate,
+		CapturedAt:    event.CapturedAt,
+		HarvestMethod: event.HarvestMethod,
+		PartCollected: event.PartCollected,
+		Images:        event.Images,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal signing payload: %v", err)
+	}
+	return payload, nil
+}
+
+// qualityTestSigningPayload serializes the signed result fields of a quality test
+func qualityTestSigningPayload(test QualityTest) ([]byte, error) {
+	payload, err := json.Marshal(qualityTestSignedPayload{
+		ID:                test.ID,
+		CollectionEventID: test.CollectionEventID,
+		BatchID:           test.BatchID,
+		LabID:             test.LabID,
+		TesterID:          test.TesterID,
+		TestDate:          test.TestDate,
+		TestTypes:         test.TestTypes,
+		Matrix:            test.Matrix,
+		MoistureContent:   test.MoistureContent,
+		PesticideResults:  test.PesticideResults,
+		HeavyMetals:       test.HeavyMetals,
+		DNABarcodeMatch:   test.DNABarcodeMatch,
+		DNASequence:       test.DNASequence,
+		MicrobialLoad:     test.MicrobialLoad,
+		Aflatoxins:        test.Aflatoxins,
+		CertificateID:     test.CertificateID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal signing payload: %v", err)
+	}
+	return payload, nil
+}
+
+// verifySignature verifies a base64-encoded signature over payload with a registered key
+func verifySignature(key *SigningKey, payload []byte, signatureB64 string) error {
+	signature, err := base64.StdEncoding.DecodeString(signatureB64)
+	if err != nil {
+		return fmt.Errorf("signature is not valid base64: %v", err)
+	}
+
+	publicKey, err := parseSigningPublicKey(key.Algorithm, key.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	switch pub := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(payload)
+		if !ecdsa.VerifyASN1(pub, digest[:], signature) {
+			return fmt.Errorf("invalid signature for key %s", key.ID)
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pub, payload, signature) {
+			return fmt.Errorf("invalid signature for key %s", key.ID)
+		}
+	default:
+		return fmt.Errorf("unsupported public key type for key %s", key.ID)
+	}
+
+	return nil
+}
+
+// parseSigningPublicKey decodes a PEM public key and checks it matches the declared algorithm
+func parseSigningPublicKey(algorithm string, publicKeyPEM string) (interface{}, error) {
+	block, _ := pem.Decode([]byte(publicKeyPEM))
+	if block == nil {
+		return nil, fmt.Errorf("public key must be PEM encoded")
+	}
+
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %v", err)
+	}
+
+	switch algorithm {
+	case AlgorithmECDSA:
+		if _, ok := publicKey.(*ecdsa.PublicKey); ok {
+			return publicKey, nil
+		}
+	case AlgorithmEd25519:
+		if _, ok := publicKey.(ed25519.PublicKey); ok {
+			return publicKey, nil
+		}
+	default:
+		return nil, fmt.Errorf("invalid algorithm: %s. Valid algorithms: ECDSA, Ed25519", algorithm)
+	}
+
+	return nil, fmt.Errorf("public key does not match algorithm %s", algorithm)
+}
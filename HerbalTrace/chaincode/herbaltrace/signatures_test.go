@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"testing"
+)
+
+// testSigningKey generates a key pair and returns it as a registered key and a signing function
+func testSigningKey(t *testing.T, algorithm string) (*SigningKey, func(payload []byte) string) {
+	t.Helper()
+
+	var publicKey interface{}
+	var sign func(payload []byte) []byte
+	switch algorithm {
+	case AlgorithmECDSA:
+		privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		publicKey = &privateKey.PublicKey
+		sign = func(payload []byte) []byte {
+			digest := sha256.Sum256(payload)
+			signature, err := ecdsa.SignASN1(rand.Reader, privateKey, digest[:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			return signature
+		}
+	case AlgorithmEd25519:
+		pub, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		publicKey = pub
+		sign = func(payload []byte) []byte {
+			return ed25519.Sign(privateKey, payload)
+		}
+	default:
+		t.Fatalf("unsupported algorithm %s", algorithm)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := &SigningKey{
+		ID:        "key-" + algorithm,
+		OwnerRole: "tester",
+		Algorithm: algorithm,
+		PublicKey: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+		Status:    "active",
+	}
+	return key, func(payload []byte) string {
+		return base64.StdEncoding.EncodeToString(sign(payload))
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	payload := []byte(`{"id":"QT001","labId":"LAB001","moistureContent":9.5}`)
+
+	for _, algorithm := range []string{AlgorithmECDSA, AlgorithmEd25519} {
+		key, sign := testSigningKey(t, algorithm)
+		otherKey, otherSign := testSigningKey(t, algorithm)
+
+		tests := []struct {
+			name      string
+			key       *SigningKey
+			payload   []byte
+			signature string
+			wantErr   bool
+		}{
+			{"valid signature", key, payload, sign(payload), false},
+			{"tampered payload", key, []byte(`{"id":"QT001","labId":"LAB001","moistureContent":7.5}`), sign(payload), true},
+			{"signed by another key", key, payload, otherSign(payload), true},
+			{"verified with another key", otherKey, payload, sign(payload), true},
+			{"signature not base64", key, payload, "not base64!", true},
+			{"empty signature", key, payload, "", true},
+		}
+		for _, tt := range tests {
+			t.Run(algorithm+"/"+tt.name, func(t *testing.T) {
+				err := verifySignature(tt.key, tt.payload, tt.signature)
+				if (err != nil) != tt.wantErr {
+					t.Errorf("verifySignature() error = %v, wantErr %v", err, tt.wantErr)
+				}
+			})
+		}
+	}
+}
+
+func TestParseSigningPublicKey(t *testing.T) {
+	ecdsaKey, _ := testSigningKey(t, AlgorithmECDSA)
+	ed25519Key, _ := testSigningKey(t, AlgorithmEd25519)
+
+	tests := []struct {
+		name      string
+		algorithm string
+		publicKey string
+		wantErr   bool
+	}{
+		{"ECDSA key", AlgorithmECDSA, ecdsaKey.PublicKey, false},
+		{"Ed25519 key", AlgorithmEd25519, ed25519Key.PublicKey, false},
+		{"ECDSA key declared as Ed25519", AlgorithmEd25519, ecdsaKey.PublicKey, true},
+		{"Ed25519 key declared as ECDSA", AlgorithmECDSA, ed25519Key.PublicKey, true},
+		{"unknown algorithm", "RSA", ecdsaKey.PublicKey, true},
+		{"not PEM", AlgorithmECDSA, "MFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAE", true},
+		{"PEM without a public key", AlgorithmECDSA, string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte("junk")})), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseSigningPublicKey(tt.algorithm, tt.publicKey)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseSigningPublicKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestQualityTestSigningPayload(t *testing.T) {
+	test := QualityTest{
+		ID:                "QT001",
+		CollectionEventID: "COL001",
+		LabID:             "LAB001",
+		TesterID:          "tester1",
+		TestDate:          "2025-10-01T10:00:00Z",
+		TestTypes:         []string{"moisture", "pesticides"},
+		MoistureContent:   9.5,
+		PesticideResults:  map[string]string{"chlorpyrifos": "pass", "atrazine": "pass"},
+		HeavyMetals:       map[string]float64{"lead": 1.2, "arsenic": 0.3},
+	}
+
+	payload, err := qualityTestSigningPayload(test)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		modify    func(test *QualityTest)
+		wantEqual bool
+	}{
+		{"unchanged", func(test *QualityTest) {}, true},
+		{"signature is not signed", func(test *QualityTest) { test.TesterSignature = "c2lnbmF0dXJl" }, true},
+		{"map order does not matter", func(test *QualityTest) {
+			test.HeavyMetals = map[string]float64{"arsenic": 0.3, "lead": 1.2}
+		}, true},
+		{"result changed", func(test *QualityTest) { test.MoistureContent = 12 }, false},
+		{"lab changed", func(test *QualityTest) { test.LabID = "LAB002" }, false},
+		{"pesticide result changed", func(test *QualityTest) {
+			test.PesticideResults = map[string]string{"chlorpyrifos": "fail", "atrazine": "pass"}
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modified := test
+			tt.modify(&modified)
+			got, err := qualityTestSigningPayload(modified)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Equal(got, payload) != tt.wantEqual {
+				t.Errorf("payload equality = %v, want %v\n got: %s\nwant: %s", !tt.wantEqual, tt.wantEqual, got, payload)
+			}
+		})
+	}
+}
+
+func TestCollectionEventSigningPayload(t *testing.T) {
+	event := CollectionEvent{
+		ID:          "COL001",
+		FarmerID:    "farmer1",
+		DeviceID:    "device1",
+		Species:     "Withania somnifera",
+		Quantity:    12.5,
+		Unit:        "kg",
+		Latitude:    30.3165,
+		Longitude:   78.0322,
+		HarvestDate: "2025-10-01",
+		CapturedAt:  "2025-10-01T06:30:00Z",
+	}
+
+	payload, err := collectionEventSigningPayload(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		modify    func(event *CollectionEvent)
+		wantEqual bool
+	}{
+		{"unchanged", func(event *CollectionEvent) {}, true},
+		{"signature is not signed", func(event *CollectionEvent) { event.FarmerSignature = "c2lnbmF0dXJl" }, true},
+		{"quantity changed", func(event *CollectionEvent) { event.Quantity = 20 }, false},
+		{"location changed", func(event *CollectionEvent) { event.Latitude = 30.4 }, false},
+		{"capture time changed", func(event *CollectionEvent) { event.CapturedAt = "2025-10-02T06:30:00Z" }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modified := event
+			tt.modify(&modified)
+			got, err := collectionEventSigningPayload(modified)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Equal(got, payload) != tt.wantEqual {
+				t.Errorf("payload equality = %v, want %v\n got: %s\nwant: %s", !tt.wantEqual, tt.wantEqual, got, payload)
+			}
+		})
+	}
+}
+
+func TestCheckSigningKeyOwner(t *testing.T) {
+	farmer := &Participant{ID: "farmer1", Role: RoleFarmer, Organization: "FarmersCoopMSP"}
+	lab := &Participant{ID: "LAB001", Role: RoleLab, Organization: "TestingLabsMSP"}
+	farmerKey := &SigningKey{ID: "key-farmer1", OwnerID: "farmer1", OwnerRole: RoleFarmer}
+	testerKey := &SigningKey{ID: "key-tester1", OwnerID: "tester1", OwnerRole: "tester", LabID: "LAB001"}
+
+	tests := []struct {
+		name     string
+		identity *ClientIdentity
+		key      *SigningKey
+		owner    *Participant
+		wantErr  bool
+	}{
+		{"farmer's own key", &ClientIdentity{MSPID: "FarmersCoopMSP", EnrollmentID: "farmer1", Role: RoleFarmer, ParticipantID: "farmer1"}, farmerKey, farmer, false},
+		{"another farmer's key", &ClientIdentity{MSPID: "FarmersCoopMSP", EnrollmentID: "farmer2", Role: RoleFarmer, ParticipantID: "farmer2"}, farmerKey, farmer, true},
+		{"supervisor of the farmer's cooperative", &ClientIdentity{MSPID: "FarmersCoopMSP", EnrollmentID: "supervisor1", Role: RoleSupervisor, ParticipantID: "supervisor1"}, farmerKey, farmer, true},
+		{"tester key of own lab", &ClientIdentity{MSPID: "TestingLabsMSP", EnrollmentID: "tester2", Role: RoleLab, ParticipantID: "LAB001"}, testerKey, lab, false},
+		{"tester key of another lab", &ClientIdentity{MSPID: "TestingLabsMSP", EnrollmentID: "tester3", Role: RoleLab, ParticipantID: "LAB002"}, testerKey, lab, true},
+		{"key of another organization", &ClientIdentity{MSPID: "ProcessorsMSP", EnrollmentID: "farmer1", Role: RoleProcessor, ParticipantID: "farmer1"}, farmerKey, farmer, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkSigningKeyOwner(tt.identity, tt.key, tt.owner)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkSigningKeyOwner() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Species is an entry of the species master registry. Records across the ledger refer to a
+// species by its canonical ID; any registered name or synonym resolves to that ID.
+type Species struct {
+	ID                   string   `json:"id"`   // Canonical ID, e.g. "withania-somnifera"
+	Type                 string   `json:"type"` // "Species"
+	ScientificName       string   `json:"scientificName"`
+	CommonName           string   `json:"commonName"`
+	Synonyms             []string `json:"synonyms,omitempty"`       // Common and vernacular names, e.g. "Ashwagandha"
+	PermittedParts       []string `json:"permittedParts,omitempty"` // Allowed PartCollected values (empty = any)
+	ConservationCategory string   `json:"conservationCategory"`     // "Least Concern", "Near Threatened", "Vulnerable", "Endangered", "Critically Endangered"
+	MinAltitude          float64  `json:"minAltitude,omitempty"`    // Known elevation range in meters (both 0 = unknown)
+	MaxAltitude          float64  `json:"maxAltitude,omitempty"`
+	MaxDailyQuantity     float64  `json:"maxDailyQuantity,omitempty"` // Most one farmer can plausibly harvest in a day (0 = no ceiling)
+	DailyQuantityUnit    string   `json:"dailyQuantityUnit,omitempty"`
+	CreatedBy            string   `json:"createdBy"`
+	CreatedAt            string   `json:"createdAt"`
+	UpdatedAt            string   `json:"updatedAt"`
+}
+
+// speciesKey returns the ledger key for a canonical species ID
+func speciesKey(speciesID string) string {
+	return "species_" + speciesID
+}
+
+// speciesAliasKey returns the ledger key mapping a species name or synonym to its canonical ID
+func speciesAliasKey(name string) string {
+	return "speciesalias_" + normalizeSpeciesName(name)
+}
+
+// normalizeSpeciesName folds case and whitespace so that spelling variants share one alias
+func normalizeSpeciesName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// RegisterSpecies adds a species to the master registry
+func (c *HerbalTraceContract) RegisterSpecies(ctx contractapi.TransactionContextInterface, speciesJSON string) error {
+	var species Species
+	err := json.Unmarshal([]byte(speciesJSON), &species)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal species JSON: %v", err)
+	}
+
+	if species.ID == "" {
+		return fmt.Errorf("species ID is required")
+	}
+	existing, err := ctx.GetStub().GetState(speciesKey(species.ID))
+	if err != nil {
+		return fmt.Errorf("failed to check if species exists: %v", err)
+	}
+	if existing != nil {
+		return fmt.Errorf("species %s already exists", species.ID)
+	}
+
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+	species.CreatedAt = txTime.Format(time.RFC3339)
+	return c.putSpecies(ctx, &species, nil, "SpeciesRegistered")
+}
+
+// UpdateSpecies replaces the names, permitted parts, conservation category, elevation range and daily
+// quantity ceiling of a species
+func (c *HerbalTraceContract) UpdateSpecies(ctx contractapi.TransactionContextInterface, speciesID string, speciesJSON string) error {
+	previous, err := c.GetSpecies(ctx, speciesID)
+	if err != nil {
+		return err
+	}
+
+	var species Species
+	err = json.Unmarshal([]byte(speciesJSON), &species)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal species JSON: %v", err)
+	}
+
+	species.ID = speciesID
+	species.CreatedAt = previous.CreatedAt
+	return c.putSpecies(ctx, &species, previous, "SpeciesUpdated")
+}
+
+// GetSpecies retrieves a species by its canonical ID
+func (c *HerbalTraceContract) GetSpecies(ctx contractapi.TransactionContextInterface, speciesID string) (*Species, error) {
+	speciesBytes, err := ctx.GetStub().GetState(speciesKey(speciesID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read species: %v", err)
+	}
+	if speciesBytes == nil {
+		return nil, fmt.Errorf("species %s does not exist", speciesID)
+	}
+
+	var species Species
+	err = json.Unmarshal(speciesBytes, &species)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal species: %v", err)
+	}
+
+	return &species, nil
+}
+
+// ResolveSpecies looks up a species by canonical ID, scientific name, common name or synonym
+func (c *HerbalTraceContract) ResolveSpecies(ctx contractapi.TransactionContextInterface, name string) (*Species, error) {
+	if strings.TrimSpace(name) == "" {
+		return nil, fmt.Errorf("species is required")
+	}
+
+	speciesID, err := ctx.GetStub().GetState(speciesAliasKey(name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read species alias: %v", err)
+	}
+	if speciesID == nil {
+		return nil, fmt.Errorf("unknown species %q; register it in the species registry first", name)
+	}
+
+	return c.GetSpecies(ctx, string(speciesID))
+}
+
+// GetAllSpecies retrieves every species in the registry
+func (c *HerbalTraceContract) GetAllSpecies(ctx contractapi.TransactionContextInterface) ([]*Species, error) {
+	resultsIterator, err := ctx.GetStub().GetQueryResult(`{"selector":{"type":"Species"}}`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query species: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	var speciesList []*Species
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var species Species
+		err = json.Unmarshal(queryResponse.Value, &species)
+		if err != nil {
+			return nil, err
+		}
+		speciesList = append(speciesList, &species)
+	}
+
+	return speciesList, nil
+}
+
+// normalizeSpecies resolves a submitted species name to its canonical ID
+func (c *HerbalTraceContract) normalizeSpecies(ctx contractapi.TransactionContextInterface, name string) (string, error) {
+	species, err := c.ResolveSpecies(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	return species.ID, nil
+}
+
+// permitsPart reports whether the species may be harvested for the given plant part
+func (s *Species) permitsPart(part string) bool {
+	if len(s.PermittedParts) == 0 {
+		return true
+	}
+	for _, permitted := range s.PermittedParts {
+		if strings.EqualFold(permitted, strings.TrimSpace(part)) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasAltitudeRange reports whether the species' elevation range is known
+func (s *Species) hasAltitudeRange() bool {
+	return s.MinAltitude != 0 || s.MaxAltitude != 0
+}
+
+// aliases returns the normalized names that resolve to the species
+func (s *Species) aliases() []string {
+	var aliases []string
+	for _, name := range append([]string{s.ID, s.ScientificName, s.CommonName}, s.Synonyms...) {
+		alias := normalizeSpeciesName(name)
+		if alias != "" && !containsString(aliases, alias) {
+			aliases = append(aliases, alias)
+		}
+	}
+	return aliases
+}
+
+// putSpecies validates and saves a species, replacing the aliases of its previous version
+func (c *HerbalTraceContract) putSpecies(ctx contractapi.TransactionContextInterface, species *Species, previous *Species, eventName string) error {
+	if species.ScientificName == "" {
+		return fmt.Errorf("scientific name is required")
+	}
+	if species.CommonName == "" {
+		return fmt.Errorf("common name is required")
+	}
+	switch species.ConservationCategory {
+	case "Least Concern", "Near Threatened", "Vulnerable", "Endangered", "Critically Endangered":
+	default:
+		return fmt.Errorf("invalid conservation category: %s", species.ConservationCategory)
+	}
+
+	if species.MinAltitude > species.MaxAltitude {
+		return fmt.Errorf("minimum altitude %.0fm is above maximum altitude %.0fm", species.MinAltitude, species.MaxAltitude)
+	}
+
+	if species.MaxDailyQuantity < 0 {
+		return fmt.Errorf("max daily quantity must not be negative")
+	}
+	if species.MaxDailyQuantity > 0 {
+		if _, err := lookupUnit(species.DailyQuantityUnit); err != nil {
+			return fmt.Errorf("daily quantity unit: %v", err)
+		}
+	}
+
+	// Every name must resolve to exactly one species
+	aliases := species.aliases()
+	for _, alias := range aliases {
+		ownerID, err := ctx.GetStub().GetState(speciesAliasKey(alias))
+		if err != nil {
+			return fmt.Errorf("failed to read species alias: %v", err)
+		}
+		if ownerID != nil && string(ownerID) != species.ID {
+			return fmt.Errorf("name %q already refers to species %s", alias, string(ownerID))
+		}
+	}
+	if previous != nil {
+		for _, alias := range previous.aliases() {
+			if containsString(aliases, alias) {
+				continue
+			}
+			if err := ctx.GetStub().DelState(speciesAliasKey(alias)); err != nil {
+				return fmt.Errorf("failed to remove species alias %q: %v", alias, err)
+			}
+		}
+	}
+	for _, alias := range aliases {
+		if err := ctx.GetStub().PutState(speciesAliasKey(alias), []byte(species.ID)); err != nil {
+			return fmt.Errorf("failed to save species alias %q: %v", alias, err)
+		}
+	}
+
+	identity, err := getClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	species.Type = "Species"
+	species.CreatedBy = identity.EnrollmentID
+	if previous != nil {
+		species.CreatedBy = previous.CreatedBy
+	}
+	species.UpdatedAt = txTime.Format(time.RFC3339)
+
+	speciesBytes, err := json.Marshal(species)
+	if err != nil {
+		return fmt.Errorf("failed to marshal species: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(speciesKey(species.ID), speciesBytes)
+	if err != nil {
+		return fmt.Errorf("failed to save species to ledger: %v", err)
+	}
+
+	// Emit event
+	eventPayload := map[string]interface{}{
+		"eventType":            eventName,
+		"speciesId":            species.ID,
+		"scientificName":       species.ScientificName,
+		"conservationCategory": species.ConservationCategory,
+		"timestamp":            species.UpdatedAt,
+	}
+	eventBytes, _ := json.Marshal(eventPayload)
+	ctx.GetStub().SetEvent(eventName, eventBytes)
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Canonical units: every limit, quota, batch and product calculation uses these
+const (
+	canonicalMassUnit   = "kg"
+	canonicalVolumeUnit = "l"
+)
+
+// quantityTolerance is the largest difference, in canonical units, between quantities treated as equal
+const quantityTolerance = 0.001
+
+// unitDefinition describes a unit of measure by its dimension and its size in the canonical unit
+type unitDefinition struct {
+	Symbol    string  // Canonical spelling of the unit
+	Dimension string  // "mass", "volume"
+	Factor    float64 // Canonical units per one of this unit
+}
+
+// units maps accepted spellings to unit definitions
+var units = map[string]unitDefinition{}
+
+func init() {
+	definitions := []struct {
+		unitDefinition
+		spellings []string
+	}{
+		{unitDefinition{"mg", "mass", 0.000001}, []string{"milligram", "milligrams"}},
+		{unitDefinition{"g", "mass", 0.001}, []string{"gm", "gms", "gram", "grams"}},
+		{unitDefinition{"kg", "mass", 1}, []string{"kgs", "kilogram", "kilograms"}},
+		{unitDefinition{"quintal", "mass", 100}, []string{"q", "qtl", "quintals"}},
+		{unitDefinition{"t", "mass", 1000}, []string{"tonne", "tonnes", "metric ton", "mt"}},
+		{unitDefinition{"ml", "volume", 0.001}, []string{"millilitre", "milliliter", "millilitres", "milliliters"}},
+		{unitDefinition{"l", "volume", 1}, []string{"ltr", "litre", "liter", "litres", "liters"}},
+		{unitDefinition{"kl", "volume", 1000}, []string{"kilolitre", "kiloliter", "kilolitres", "kiloliters"}},
+	}
+	for _, definition := range definitions {
+		units[definition.Symbol] = definition.unitDefinition
+		for _, spelling := range definition.spellings {
+			units[spelling] = definition.unitDefinition
+		}
+	}
+}
+
+// lookupUnit returns the definition of a unit, accepting any registered spelling
+func lookupUnit(unit string) (unitDefinition, error) {
+	definition, ok := units[strings.ToLower(strings.TrimSpace(unit))]
+	if !ok {
+		return unitDefinition{}, fmt.Errorf("unknown unit %q; use a mass (mg, g, kg, quintal, t) or volume (ml, l, kl) unit", unit)
+	}
+	return definition, nil
+}
+
+// canonicalUnitFor returns the canonical unit of a dimension
+func canonicalUnitFor(dimension string) string {
+	if dimension == "volume" {
+		return canonicalVolumeUnit
+	}
+	return canonicalMassUnit
+}
+
+// toCanonical converts a quantity to the canonical unit of its dimension
+func toCanonical(quantity float64, unit string) (float64, string, error) {
+	definition, err := lookupUnit(unit)
+	if err != nil {
+		return 0, "", err
+	}
+	return roundQuantity(quantity * definition.Factor), canonicalUnitFor(definition.Dimension), nil
+}
+
+// convertQuantity converts a quantity between two units of the same dimension
+func convertQuantity(quantity float64, from string, to string) (float64, error) {
+	fromDefinition, err := lookupUnit(from)
+	if err != nil {
+		return 0, err
+	}
+	toDefinition, err := lookupUnit(to)
+	if err != nil {
+		return 0, err
+	}
+	if fromDefinition.Dimension != toDefinition.Dimension {
+		return 0, fmt.Errorf("incompatible units: %s (%s) cannot be converted to %s (%s)",
+			from, fromDefinition.Dimension, to, toDefinition.Dimension)
+	}
+	return roundQuantity(quantity * fromDefinition.Factor / toDefinition.Factor), nil
+}
+
+// roundQuantity drops floating point noise from unit conversions (to a milligram or millilitre)
+func roundQuantity(quantity float64) float64 {
+	return math.Round(quantity*1e6) / 1e6
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestLookupUnit(t *testing.T) {
+	tests := []struct {
+		unit          string
+		wantSymbol    string
+		wantDimension string
+		wantErr       bool
+	}{
+		{"kg", "kg", "mass", false},
+		{" KGS ", "kg", "mass", false},
+		{"Grams", "g", "mass", false},
+		{"qtl", "quintal", "mass", false},
+		{"metric ton", "t", "mass", false},
+		{"Litres", "l", "volume", false},
+		{"milliliter", "ml", "volume", false},
+		{"pound", "", "", true},
+		{"", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.unit, func(t *testing.T) {
+			definition, err := lookupUnit(tt.unit)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("lookupUnit(%q) error = %v, wantErr %v", tt.unit, err, tt.wantErr)
+			}
+			if definition.Symbol != tt.wantSymbol || definition.Dimension != tt.wantDimension {
+				t.Errorf("lookupUnit(%q) = %s (%s), want %s (%s)", tt.unit,
+					definition.Symbol, definition.Dimension, tt.wantSymbol, tt.wantDimension)
+			}
+		})
+	}
+}
+
+func TestToCanonical(t *testing.T) {
+	tests := []struct {
+		quantity     float64
+		unit         string
+		wantQuantity float64
+		wantUnit     string
+		wantErr      bool
+	}{
+		{2.5, "kg", 2.5, "kg", false},
+		{1500, "g", 1.5, "kg", false},
+		{3, "quintal", 300, "kg", false},
+		{0.25, "t", 250, "kg", false},
+		{250, "mg", 0.00025, "kg", false},
+		{750, "ml", 0.75, "l", false},
+		{2, "kl", 2000, "l", false},
+		{1, "bushel", 0, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.unit, func(t *testing.T) {
+			quantity, unit, err := toCanonical(tt.quantity, tt.unit)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("toCanonical(%v, %q) error = %v, wantErr %v", tt.quantity, tt.unit, err, tt.wantErr)
+			}
+			if quantity != tt.wantQuantity || unit != tt.wantUnit {
+				t.Errorf("toCanonical(%v, %q) = %v %s, want %v %s", tt.quantity, tt.unit, quantity, unit, tt.wantQuantity, tt.wantUnit)
+			}
+		})
+	}
+}
+
+func TestConvertQuantity(t *testing.T) {
+	tests := []struct {
+		name     string
+		quantity float64
+		from, to string
+		want     float64
+		wantErr  bool
+	}{
+		{"same unit", 12.5, "kg", "kg", 12.5, false},
+		{"kilograms to grams", 1.2, "kg", "g", 1200, false},
+		{"grams to quintals", 25000, "g", "quintal", 0.25, false},
+		{"tonnes to kilograms", 1.1, "tonnes", "kg", 1100, false},
+		{"litres to millilitres", 0.3, "l", "ml", 300, false},
+		{"mass to volume", 1, "kg", "l", 0, true},
+		{"volume to mass", 1, "ml", "g", 0, true},
+		{"unknown source unit", 1, "oz", "kg", 0, true},
+		{"unknown target unit", 1, "kg", "oz", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := convertQuantity(tt.quantity, tt.from, tt.to)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("convertQuantity(%v, %q, %q) error = %v, wantErr %v", tt.quantity, tt.from, tt.to, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("convertQuantity(%v, %q, %q) = %v, want %v", tt.quantity, tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoundQuantity(t *testing.T) {
+	tests := []struct {
+		quantity float64
+		want     float64
+	}{
+		{0.1 + 0.2, 0.3},
+		{1.0000004, 1},
+		{1.0000006, 1.000001},
+		{-2.5000004, -2.5},
+		{42, 42},
+	}
+	for _, tt := range tests {
+		if got := roundQuantity(tt.quantity); got != tt.want {
+			t.Errorf("roundQuantity(%v) = %v, want %v", tt.quantity, got, tt.want)
+		}
+	}
+}
@@ -3,45 +3,92 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"strconv"
-	"strings"
 	"time"
 
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
 
-// SeasonWindow represents the allowed harvest period for a species in a region
+// SeasonWindow represents the allowed harvest period for a species in a region.
+// The recurring period runs from StartMonthDay to EndMonthDay (inclusive) every year; windows
+// created with months only cover whole months. A year override replaces the recurring period of
+// the season starting in that year with explicit dates, and closures shut the window early.
 type SeasonWindow struct {
+	ID            string               `json:"id"`
+	Type          string               `json:"type"` // "SeasonWindow"
+	Species       string               `json:"species"`
+	StartMonth    int                  `json:"startMonth"`              // 1-12
+	EndMonth      int                  `json:"endMonth"`                // 1-12
+	StartMonthDay string               `json:"startMonthDay,omitempty"` // "MM-DD", e.g. "04-15"
+	EndMonthDay   string               `json:"endMonthDay,omitempty"`   // "MM-DD", inclusive
+	YearOverrides []SeasonYearOverride `json:"yearOverrides,omitempty"`
+	Closures      []SeasonClosure      `json:"closures,omitempty"`
+	Region        string               `json:"region"`
+	Active        bool                 `json:"active"`
+	CreatedBy     string               `json:"createdBy"`
+	CreatedByMSP  string               `json:"createdByMsp,omitempty"` // MSP ID of the creating identity
+	CreatedAt     string               `json:"createdAt"`
+	UpdatedAt     string               `json:"updatedAt"`
+}
+
+// SeasonYearOverride sets the exact opening and closing dates announced for one year's season
+type SeasonYearOverride struct {
+	Year      int    `json:"year"`      // Year in which the season opens
+	StartDate string `json:"startDate"` // YYYY-MM-DD
+	EndDate   string `json:"endDate"`   // YYYY-MM-DD, inclusive
+	Notice    string `json:"notice,omitempty"`
+}
+
+// SeasonClosure is an emergency closure of a season window
+type SeasonClosure struct {
 	ID         string `json:"id"`
-	Type       string `json:"type"` // "SeasonWindow"
-	Species    string `json:"species"`
-	StartMonth int    `json:"startMonth"` // 1-12
-	EndMonth   int    `json:"endMonth"`   // 1-12
-	Region     string `json:"region"`
-	Active     bool   `json:"active"`
-	CreatedBy  string `json:"createdBy"`
-	CreatedAt  string `json:"createdAt"`
-	UpdatedAt  string `json:"updatedAt"`
+	From       string `json:"from"`            // YYYY-MM-DD
+	Until      string `json:"until,omitempty"` // YYYY-MM-DD, inclusive; empty = until lifted
+	Reason     string `json:"reason"`
+	DeclaredBy string `json:"declaredBy"`
+	DeclaredAt string `json:"declaredAt"`
+	LiftedBy   string `json:"liftedBy,omitempty"`
+	LiftedAt   string `json:"liftedAt,omitempty"`
+}
+
+// SeasonCheck explains how one season window was evaluated for a harvest date
+type SeasonCheck struct {
+	WindowID string `json:"windowId"`
+	Matched  bool   `json:"matched"`
+	Reason   string `json:"reason"`
+}
+
+// SeasonValidationResult reports whether a harvest date is in season, which window matched,
+// and why each window did or did not match
+type SeasonValidationResult struct {
+	InSeason bool          `json:"inSeason"`
+	WindowID string        `json:"windowId,omitempty"`
+	Reason   string        `json:"reason"`
+	Checks   []SeasonCheck `json:"checks"`
 }
 
 // HarvestLimit represents harvest quantity limits for a species in a zone/season
 type HarvestLimit struct {
-	ID              string  `json:"id"`
-	Type            string  `json:"type"` // "HarvestLimit"
-	Species         string  `json:"species"`
-	Season          string  `json:"season"` // "2025-Spring", "2025-Monsoon", "2025-Post-Monsoon", "2025-Winter"
-	Zone            string  `json:"zone"`
-	MaxQuantity     float64 `json:"maxQuantity"`
-	CurrentQuantity float64 `json:"currentQuantity"`
-	Unit            string  `json:"unit"`
-	AlertThreshold  float64 `json:"alertThreshold"` // Percentage (e.g., 80.0 for 80%)
-	Status          string  `json:"status"`         // "normal", "warning", "exceeded"
-	CreatedBy       string  `json:"createdBy"`
-	CreatedAt       string  `json:"createdAt"`
-	UpdatedAt       string  `json:"updatedAt"`
+	ID                   string  `json:"id"`
+	Type                 string  `json:"type"` // "HarvestLimit"
+	Species              string  `json:"species"`
+	Season               string  `json:"season"`                // "2025-Spring", "2025-Monsoon", "2025-Post-Monsoon", "2025-Winter"
+	Zone                 string  `json:"zone"`                  // "*" = every zone (farmer and cooperative quotas only)
+	FarmerID             string  `json:"farmerId,omitempty"`    // Set for a per-farmer quota
+	Cooperative          string  `json:"cooperative,omitempty"` // MSP ID, set for a per-cooperative quota
+	MaxQuantity          float64 `json:"maxQuantity"`           // In the canonical unit
+	CurrentQuantity      float64 `json:"currentQuantity"`
+	Unit                 string  `json:"unit"`                           // Canonical unit, "kg" or "l"
+	SubmittedMaxQuantity float64 `json:"submittedMaxQuantity,omitempty"` // Max quantity as submitted
+	SubmittedUnit        string  `json:"submittedUnit,omitempty"`
+	AlertThreshold       float64 `json:"alertThreshold"` // Percentage (e.g., 80.0 for 80%)
+	Status               string  `json:"status"`         // "normal", "warning", "exceeded"
+	CreatedBy            string  `json:"createdBy"`
+	CreatedByMSP         string  `json:"createdByMsp,omitempty"` // MSP ID of the creating identity
+	CreatedAt            string  `json:"createdAt"`
+	UpdatedAt            string  `json:"updatedAt"`
 }
 
-// CreateSeasonWindow creates a new season window for a species
+// CreateSeasonWindow creates a new season window for a species (governed: applied through ExecuteProposal)
 func (c *HerbalTraceContract) CreateSeasonWindow(ctx contractapi.TransactionContextInterface, windowJSON string) error {
 	var window SeasonWindow
 	err := json.Unmarshal([]byte(windowJSON), &window)
@@ -56,15 +103,16 @@ func (c *HerbalTraceContract) CreateSeasonWindow(ctx contractapi.TransactionCont
 	if window.Species == "" {
 		return fmt.Errorf("species is required")
 	}
-	if window.StartMonth < 1 || window.StartMonth > 12 {
-		return fmt.Errorf("start month must be between 1 and 12")
-	}
-	if window.EndMonth < 1 || window.EndMonth > 12 {
-		return fmt.Errorf("end month must be between 1 and 12")
+	if err := normalizeSeasonPeriod(&window); err != nil {
+		return err
 	}
 	if window.Region == "" {
 		return fmt.Errorf("region is required")
 	}
+	window.Species, err = c.normalizeSpecies(ctx, window.Species)
+	if err != nil {
+		return err
+	}
 
 	// Check if season window already exists
 	existingWindow, err := ctx.GetStub().GetState(window.ID)
@@ -75,11 +123,23 @@ func (c *HerbalTraceContract) CreateSeasonWindow(ctx contractapi.TransactionCont
 		return fmt.Errorf("season window with ID %s already exists", window.ID)
 	}
 
+	identity, err := getClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+
 	// Set default values
 	window.Type = "SeasonWindow"
 	window.Active = true
-	window.CreatedAt = time.Now().Format(time.RFC3339)
-	window.UpdatedAt = time.Now().Format(time.RFC3339)
+	window.Closures = nil
+	window.CreatedBy = identity.EnrollmentID
+	window.CreatedByMSP = identity.MSPID
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+	window.CreatedAt = txTime.Format(time.RFC3339)
+	window.UpdatedAt = txTime.Format(time.RFC3339)
 
 	// Save to ledger
 	windowBytes, err := json.Marshal(window)
@@ -108,18 +168,19 @@ func (c *HerbalTraceContract) CreateSeasonWindow(ctx contractapi.TransactionCont
 	return nil
 }
 
-// ValidateSeasonWindow checks if a harvest date falls within the allowed season window
-func (c *HerbalTraceContract) ValidateSeasonWindow(ctx contractapi.TransactionContextInterface, species string, harvestDate string, region string) (bool, error) {
+// ValidateSeasonWindow checks if a harvest date falls within an active season window for the
+// species and region, honouring year overrides and emergency closures. The result names the
+// matching window, or explains why each window did not match.
+func (c *HerbalTraceContract) ValidateSeasonWindow(ctx contractapi.TransactionContextInterface, species string, harvestDate string, region string) (*SeasonValidationResult, error) {
 	if species == "" || harvestDate == "" || region == "" {
-		return false, fmt.Errorf("species, harvest date, and region are required")
+		return nil, fmt.Errorf("species, harvest date, and region are required")
 	}
 
 	// Parse harvest date
-	parsedDate, err := time.Parse(time.RFC3339, harvestDate)
+	parsedDate, err := parseLedgerDate(harvestDate)
 	if err != nil {
-		return false, fmt.Errorf("invalid harvest date format: %v", err)
+		return nil, fmt.Errorf("invalid harvest date format: %v", err)
 	}
-	harvestMonth := int(parsedDate.Month())
 
 	// Query for active season windows for this species and region
 	queryString := fmt.Sprintf(`{
@@ -133,11 +194,13 @@ func (c *HerbalTraceContract) ValidateSeasonWindow(ctx contractapi.TransactionCo
 
 	resultsIterator, err := ctx.GetStub().GetQueryResult(queryString)
 	if err != nil {
-		return false, fmt.Errorf("failed to query season windows: %v", err)
+		return nil, fmt.Errorf("failed to query season windows: %v", err)
 	}
 	defer resultsIterator.Close()
 
-	// Check if harvest month falls within any active season window
+	result := &SeasonValidationResult{Checks: []SeasonCheck{}}
+
+	// Check if the harvest date falls within any active season window
 	for resultsIterator.HasNext() {
 		queryResponse, err := resultsIterator.Next()
 		if err != nil {
@@ -150,22 +213,290 @@ func (c *HerbalTraceContract) ValidateSeasonWindow(ctx contractapi.TransactionCo
 			continue
 		}
 
-		// Check if harvest month is within season window
-		if window.StartMonth <= window.EndMonth {
-			// Normal case: e.g., April (4) to September (9)
-			if harvestMonth >= window.StartMonth && harvestMonth <= window.EndMonth {
-				return true, nil
-			}
-		} else {
-			// Wrap-around case: e.g., November (11) to February (2)
-			if harvestMonth >= window.StartMonth || harvestMonth <= window.EndMonth {
-				return true, nil
+		matched, reason := window.evaluate(parsedDate)
+		result.Checks = append(result.Checks, SeasonCheck{WindowID: window.ID, Matched: matched, Reason: reason})
+		if matched && !result.InSeason {
+			result.InSeason = true
+			result.WindowID = window.ID
+			result.Reason = reason
+		}
+	}
+
+	if !result.InSeason {
+		switch len(result.Checks) {
+		case 0:
+			result.Reason = fmt.Sprintf("no active season window for species %s in region %s", species, region)
+		case 1:
+			result.Reason = result.Checks[0].Reason
+		default:
+			result.Reason = fmt.Sprintf("none of %d season windows for species %s in region %s is open on %s",
+				len(result.Checks), species, region, parsedDate.Format("2006-01-02"))
+		}
+	}
+
+	return result, nil
+}
+
+// DeclareSeasonClosure closes a season window with immediate effect, e.g. after an early
+// closure announced by the forest department
+func (c *HerbalTraceContract) DeclareSeasonClosure(ctx contractapi.TransactionContextInterface, windowID string, closureJSON string) error {
+	window, err := c.getSeasonWindow(ctx, windowID)
+	if err != nil {
+		return err
+	}
+
+	var closure SeasonClosure
+	err = json.Unmarshal([]byte(closureJSON), &closure)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal season closure JSON: %v", err)
+	}
+	if closure.ID == "" {
+		return fmt.Errorf("closure ID is required")
+	}
+	if closure.Reason == "" {
+		return fmt.Errorf("closure reason is required")
+	}
+	for _, existing := range window.Closures {
+		if existing.ID == closure.ID {
+			return fmt.Errorf("closure %s already exists on season window %s", closure.ID, windowID)
+		}
+	}
+	from, err := parseLedgerDate(closure.From)
+	if err != nil {
+		return fmt.Errorf("invalid closure start date: %v", err)
+	}
+	if closure.Until != "" {
+		until, err := parseLedgerDate(closure.Until)
+		if err != nil {
+			return fmt.Errorf("invalid closure end date: %v", err)
+		}
+		if until.Before(from) {
+			return fmt.Errorf("closure ends before it starts")
+		}
+	}
+
+	identity, err := getClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	closure.DeclaredBy = identity.EnrollmentID
+	closure.DeclaredAt = txTime.Format(time.RFC3339)
+	closure.LiftedBy = ""
+	closure.LiftedAt = ""
+	window.Closures = append(window.Closures, closure)
+	window.UpdatedAt = closure.DeclaredAt
+
+	if err := c.putSeasonWindow(ctx, window); err != nil {
+		return err
+	}
+
+	// Emit event
+	eventPayload := map[string]interface{}{
+		"eventType": "SeasonClosureDeclared",
+		"windowId":  window.ID,
+		"closureId": closure.ID,
+		"species":   window.Species,
+		"region":    window.Region,
+		"from":      closure.From,
+		"until":     closure.Until,
+		"reason":    closure.Reason,
+		"timestamp": closure.DeclaredAt,
+	}
+	eventBytes, _ := json.Marshal(eventPayload)
+	ctx.GetStub().SetEvent("SeasonClosureDeclared", eventBytes)
+
+	return nil
+}
+
+// LiftSeasonClosure reopens a season window closed by an emergency closure
+// (governed: applied through ExecuteProposal)
+func (c *HerbalTraceContract) LiftSeasonClosure(ctx contractapi.TransactionContextInterface, windowID string, closureID string) error {
+	window, err := c.getSeasonWindow(ctx, windowID)
+	if err != nil {
+		return err
+	}
+
+	identity, err := getClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i := range window.Closures {
+		closure := &window.Closures[i]
+		if closure.ID != closureID {
+			continue
+		}
+		if closure.LiftedAt != "" {
+			return fmt.Errorf("closure %s was already lifted", closureID)
+		}
+		closure.LiftedBy = identity.EnrollmentID
+		closure.LiftedAt = txTime.Format(time.RFC3339)
+		window.UpdatedAt = closure.LiftedAt
+		return c.putSeasonWindow(ctx, window)
+	}
+
+	return fmt.Errorf("closure %s does not exist on season window %s", closureID, windowID)
+}
+
+// evaluate reports whether the window is open on a date, with the reason
+func (w *SeasonWindow) evaluate(date time.Time) (bool, string) {
+	day := date.Format("2006-01-02")
+
+	for _, closure := range w.Closures {
+		if closure.LiftedAt != "" {
+			continue
+		}
+		from, err := parseLedgerDate(closure.From)
+		if err != nil || date.Before(from) {
+			continue
+		}
+		if closure.Until != "" {
+			until, err := parseLedgerDate(closure.Until)
+			if err != nil || !date.Before(until.AddDate(0, 0, 1)) {
+				continue
 			}
 		}
+		return false, fmt.Sprintf("window %s is closed from %s: %s", w.ID, closure.From, closure.Reason)
+	}
+
+	for _, override := range w.YearOverrides {
+		start, errStart := parseLedgerDate(override.StartDate)
+		end, errEnd := parseLedgerDate(override.EndDate)
+		if errStart != nil || errEnd != nil {
+			continue
+		}
+		if !date.Before(start) && date.Before(end.AddDate(0, 0, 1)) {
+			return true, fmt.Sprintf("%s is within the %d dates of window %s (%s to %s)",
+				day, override.Year, w.ID, override.StartDate, override.EndDate)
+		}
 	}
 
-	// No valid season window found
-	return false, nil
+	start := monthDayValue(w.StartMonthDay)
+	end := monthDayValue(w.EndMonthDay)
+	current := int(date.Month())*100 + date.Day()
+
+	var inRecurring bool
+	seasonYear := date.Year()
+	if start <= end {
+		// Normal case: e.g., 15 April to 30 September
+		inRecurring = current >= start && current <= end
+	} else {
+		// Wrap-around case: e.g., November to February
+		inRecurring = current >= start || current <= end
+		if current <= end {
+			seasonYear--
+		}
+	}
+	if !inRecurring {
+		return false, fmt.Sprintf("%s is outside window %s (%s to %s)", day, w.ID, w.StartMonthDay, w.EndMonthDay)
+	}
+
+	for _, override := range w.YearOverrides {
+		if override.Year == seasonYear {
+			return false, fmt.Sprintf("%s is outside the %d dates of window %s (%s to %s)",
+				day, seasonYear, w.ID, override.StartDate, override.EndDate)
+		}
+	}
+
+	return true, fmt.Sprintf("%s is within window %s (%s to %s)", day, w.ID, w.StartMonthDay, w.EndMonthDay)
+}
+
+// normalizeSeasonPeriod validates the period of a season window and fills the month-day bounds
+// from the months for windows defined by month only
+func normalizeSeasonPeriod(window *SeasonWindow) error {
+	if window.StartMonthDay == "" {
+		if window.StartMonth < 1 || window.StartMonth > 12 {
+			return fmt.Errorf("start month must be between 1 and 12")
+		}
+		window.StartMonthDay = fmt.Sprintf("%02d-01", window.StartMonth)
+	}
+	if window.EndMonthDay == "" {
+		if window.EndMonth < 1 || window.EndMonth > 12 {
+			return fmt.Errorf("end month must be between 1 and 12")
+		}
+		// Day 0 of the next month is the last day of this month; 2024 counts 29 February
+		lastDay := time.Date(2024, time.Month(window.EndMonth)+1, 0, 0, 0, 0, 0, time.UTC).Day()
+		window.EndMonthDay = fmt.Sprintf("%02d-%02d", window.EndMonth, lastDay)
+	}
+
+	for _, monthDay := range []string{window.StartMonthDay, window.EndMonthDay} {
+		if _, err := time.Parse("2006-01-02", "2024-"+monthDay); err != nil {
+			return fmt.Errorf("invalid month-day %q; expected MM-DD", monthDay)
+		}
+	}
+	window.StartMonth = monthDayValue(window.StartMonthDay) / 100
+	window.EndMonth = monthDayValue(window.EndMonthDay) / 100
+
+	for _, override := range window.YearOverrides {
+		start, err := parseLedgerDate(override.StartDate)
+		if err != nil {
+			return fmt.Errorf("invalid start date for %d: %v", override.Year, err)
+		}
+		end, err := parseLedgerDate(override.EndDate)
+		if err != nil {
+			return fmt.Errorf("invalid end date for %d: %v", override.Year, err)
+		}
+		if end.Before(start) {
+			return fmt.Errorf("season dates for %d end before they start", override.Year)
+		}
+		if start.Year() != override.Year {
+			return fmt.Errorf("season dates for %d must open in that year", override.Year)
+		}
+	}
+
+	return nil
+}
+
+// monthDayValue converts "MM-DD" to MM*100+DD for ordering within a year
+func monthDayValue(monthDay string) int {
+	parsed, err := time.Parse("2006-01-02", "2024-"+monthDay)
+	if err != nil {
+		return 0
+	}
+	return int(parsed.Month())*100 + parsed.Day()
+}
+
+// getSeasonWindow reads a season window by ID
+func (c *HerbalTraceContract) getSeasonWindow(ctx contractapi.TransactionContextInterface, windowID string) (*SeasonWindow, error) {
+	windowBytes, err := ctx.GetStub().GetState(windowID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read season window: %v", err)
+	}
+	if windowBytes == nil {
+		return nil, fmt.Errorf("season window with ID %s does not exist", windowID)
+	}
+
+	var window SeasonWindow
+	err = json.Unmarshal(windowBytes, &window)
+	if err != nil || window.Type != "SeasonWindow" {
+		return nil, fmt.Errorf("%s is not a season window", windowID)
+	}
+
+	return &window, nil
+}
+
+// putSeasonWindow writes a season window to the ledger
+func (c *HerbalTraceContract) putSeasonWindow(ctx contractapi.TransactionContextInterface, window *SeasonWindow) error {
+	windowBytes, err := json.Marshal(window)
+	if err != nil {
+		return fmt.Errorf("failed to marshal season window: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(window.ID, windowBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update season window: %v", err)
+	}
+
+	return nil
 }
 
 // GetSeasonWindows retrieves all season windows for a species
@@ -205,7 +536,7 @@ func (c *HerbalTraceContract) GetSeasonWindows(ctx contractapi.TransactionContex
 	return windows, nil
 }
 
-// UpdateSeasonWindow updates an existing season window
+// UpdateSeasonWindow updates an existing season window (governed: applied through ExecuteProposal)
 func (c *HerbalTraceContract) UpdateSeasonWindow(ctx contractapi.TransactionContextInterface, windowID string, windowJSON string) error {
 	if windowID == "" {
 		return fmt.Errorf("window ID is required")
@@ -226,10 +557,29 @@ func (c *HerbalTraceContract) UpdateSeasonWindow(ctx contractapi.TransactionCont
 		return fmt.Errorf("failed to unmarshal season window JSON: %v", err)
 	}
 
+	updatedWindow.Species, err = c.normalizeSpecies(ctx, updatedWindow.Species)
+	if err != nil {
+		return err
+	}
+	if err := normalizeSeasonPeriod(&updatedWindow); err != nil {
+		return err
+	}
+
+	// Closures are only declared and lifted through their own transactions
+	var existingWindow SeasonWindow
+	if err := json.Unmarshal(existingBytes, &existingWindow); err != nil {
+		return fmt.Errorf("failed to unmarshal season window: %v", err)
+	}
+	updatedWindow.Closures = existingWindow.Closures
+
 	// Preserve ID and type
 	updatedWindow.ID = windowID
 	updatedWindow.Type = "SeasonWindow"
-	updatedWindow.UpdatedAt = time.Now().Format(time.RFC3339)
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+	updatedWindow.UpdatedAt = txTime.Format(time.RFC3339)
 
 	// Save updated window
 	windowBytes, err := json.Marshal(updatedWindow)
@@ -245,7 +595,9 @@ func (c *HerbalTraceContract) UpdateSeasonWindow(ctx contractapi.TransactionCont
 	return nil
 }
 
-// CreateHarvestLimit creates a new harvest limit for a species/zone/season
+// CreateHarvestLimit creates a new harvest limit for a species/zone/season. The ID is derived from the
+// canonical species, zone and season (and the quota holder), so a submitted ID is ignored.
+// (governed: applied through ExecuteProposal)
 func (c *HerbalTraceContract) CreateHarvestLimit(ctx contractapi.TransactionContextInterface, limitJSON string) error {
 	var limit HarvestLimit
 	err := json.Unmarshal([]byte(limitJSON), &limit)
@@ -254,24 +606,53 @@ func (c *HerbalTraceContract) CreateHarvestLimit(ctx contractapi.TransactionCont
 	}
 
 	// Validate required fields
-	if limit.ID == "" {
-		return fmt.Errorf("harvest limit ID is required")
-	}
 	if limit.Species == "" {
 		return fmt.Errorf("species is required")
 	}
 	if limit.Season == "" {
 		return fmt.Errorf("season is required")
 	}
+	if limit.FarmerID != "" && limit.Cooperative != "" {
+		return fmt.Errorf("a harvest quota applies to either a farmer or a cooperative, not both")
+	}
+	isQuota := limit.FarmerID != "" || limit.Cooperative != ""
+	if limit.Zone == "" && isQuota {
+		limit.Zone = allZones
+	}
 	if limit.Zone == "" {
 		return fmt.Errorf("zone is required")
 	}
+	if limit.Zone == allZones && !isQuota {
+		return fmt.Errorf("zone limits must name a zone")
+	}
 	if limit.MaxQuantity <= 0 {
 		return fmt.Errorf("max quantity must be greater than zero")
 	}
 	if limit.Unit == "" {
 		return fmt.Errorf("unit is required")
 	}
+	limit.SubmittedMaxQuantity = limit.MaxQuantity
+	limit.SubmittedUnit = limit.Unit
+	limit.MaxQuantity, limit.Unit, err = toCanonical(limit.MaxQuantity, limit.Unit)
+	if err != nil {
+		return err
+	}
+	limit.Species, err = c.normalizeSpecies(ctx, limit.Species)
+	if err != nil {
+		return err
+	}
+
+	// Limits and quotas are keyed so that CreateCollectionEvent can find them without a query
+	if limit.FarmerID != "" {
+		if _, err := c.GetParticipant(ctx, limit.FarmerID); err != nil {
+			return err
+		}
+		limit.ID = harvestQuotaKey(limit.Species, limit.Zone, limit.Season, "farmer", limit.FarmerID)
+	} else if limit.Cooperative != "" {
+		limit.ID = harvestQuotaKey(limit.Species, limit.Zone, limit.Season, "cooperative", limit.Cooperative)
+	} else {
+		limit.ID = harvestLimitKey(limit.Species, limit.Zone, limit.Season)
+	}
 
 	// Check if harvest limit already exists
 	existingLimit, err := ctx.GetStub().GetState(limit.ID)
@@ -282,6 +663,11 @@ func (c *HerbalTraceContract) CreateHarvestLimit(ctx contractapi.TransactionCont
 		return fmt.Errorf("harvest limit with ID %s already exists", limit.ID)
 	}
 
+	identity, err := getClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+
 	// Set default values
 	limit.Type = "HarvestLimit"
 	limit.CurrentQuantity = 0
@@ -289,8 +675,14 @@ func (c *HerbalTraceContract) CreateHarvestLimit(ctx contractapi.TransactionCont
 	if limit.AlertThreshold == 0 {
 		limit.AlertThreshold = 80.0 // Default 80%
 	}
-	limit.CreatedAt = time.Now().Format(time.RFC3339)
-	limit.UpdatedAt = time.Now().Format(time.RFC3339)
+	limit.CreatedBy = identity.EnrollmentID
+	limit.CreatedByMSP = identity.MSPID
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+	limit.CreatedAt = txTime.Format(time.RFC3339)
+	limit.UpdatedAt = txTime.Format(time.RFC3339)
 
 	// Save to ledger
 	limitBytes, err := json.Marshal(limit)
@@ -306,39 +698,53 @@ func (c *HerbalTraceContract) CreateHarvestLimit(ctx contractapi.TransactionCont
 	return nil
 }
 
-// TrackHarvestQuantity adds a quantity to the current harvest limit tracker
-func (c *HerbalTraceContract) TrackHarvestQuantity(ctx contractapi.TransactionContextInterface, species string, zone string, season string, quantity float64) error {
+// TrackHarvestQuantity adds a quantity, converted to the limit's unit, to the current harvest limit tracker
+func (c *HerbalTraceContract) TrackHarvestQuantity(ctx contractapi.TransactionContextInterface, species string, zone string, season string, quantity float64, unit string) error {
+	_, _, err := c.trackHarvestLimit(ctx, species, zone, season, quantity, unit)
+	return err
+}
+
+// trackHarvestLimit adds a quantity to the harvest limit tracker and returns the updated limit, which
+// Fabric does not let the same transaction read back, and its status before the update. The limit
+// is nil when none is set.
+func (c *HerbalTraceContract) trackHarvestLimit(ctx contractapi.TransactionContextInterface, species string, zone string, season string, quantity float64, unit string) (*HarvestLimit, string, error) {
 	if species == "" || zone == "" || season == "" {
-		return fmt.Errorf("species, zone, and season are required")
+		return nil, "", fmt.Errorf("species, zone, and season are required")
 	}
 	if quantity <= 0 {
-		return fmt.Errorf("quantity must be greater than zero")
+		return nil, "", fmt.Errorf("quantity must be greater than zero")
 	}
 
 	// Find the harvest limit for this species/zone/season
-	limitID := fmt.Sprintf("limit_%s_%s_%s", 
-		strings.ReplaceAll(species, " ", "_"),
-		strings.ReplaceAll(zone, " ", "_"),
-		strings.ReplaceAll(season, " ", "_"))
+	limitID := harvestLimitKey(species, zone, season)
 
 	limitBytes, err := ctx.GetStub().GetState(limitID)
 	if err != nil {
-		return fmt.Errorf("failed to read harvest limit: %v", err)
+		return nil, "", fmt.Errorf("failed to read harvest limit: %v", err)
 	}
 	if limitBytes == nil {
 		// No limit set for this combination - allow harvest
-		return nil
+		return nil, "", nil
 	}
 
 	var limit HarvestLimit
 	err = json.Unmarshal(limitBytes, &limit)
 	if err != nil {
-		return fmt.Errorf("failed to unmarshal harvest limit: %v", err)
+		return nil, "", fmt.Errorf("failed to unmarshal harvest limit: %v", err)
+	}
+	quantity, err = convertQuantity(quantity, unit, limit.Unit)
+	if err != nil {
+		return nil, "", err
 	}
 
 	// Update current quantity
-	limit.CurrentQuantity += quantity
-	limit.UpdatedAt = time.Now().Format(time.RFC3339)
+	previousStatus := limit.Status
+	limit.CurrentQuantity = roundQuantity(limit.CurrentQuantity + quantity)
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	limit.UpdatedAt = txTime.Format(time.RFC3339)
 
 	// Calculate percentage used
 	percentageUsed := (limit.CurrentQuantity / limit.MaxQuantity) * 100
@@ -355,54 +761,70 @@ func (c *HerbalTraceContract) TrackHarvestQuantity(ctx contractapi.TransactionCo
 	// Save updated limit
 	limitBytes, err = json.Marshal(limit)
 	if err != nil {
-		return fmt.Errorf("failed to marshal harvest limit: %v", err)
+		return nil, "", fmt.Errorf("failed to marshal harvest limit: %v", err)
 	}
 
 	err = ctx.GetStub().PutState(limitID, limitBytes)
 	if err != nil {
-		return fmt.Errorf("failed to update harvest limit: %v", err)
+		return nil, "", fmt.Errorf("failed to update harvest limit: %v", err)
 	}
 
-	return nil
+	return &limit, previousStatus, nil
+}
+
+// ValidateHarvestLimit checks if adding a quantity would exceed the harvest limit. Quantities in a unit
+// that cannot be converted to the limit's unit are rejected.
+func (c *HerbalTraceContract) ValidateHarvestLimit(ctx contractapi.TransactionContextInterface, species string, zone string, season string, quantity float64, unit string) (bool, error) {
+	withinLimit, refusal, err := c.checkHarvestLimit(ctx, species, zone, season, quantity, unit)
+	if err != nil {
+		return false, err
+	}
+	if refusal != "" {
+		return false, fmt.Errorf("%s", refusal)
+	}
+
+	return withinLimit, nil
 }
 
-// ValidateHarvestLimit checks if adding a quantity would exceed the harvest limit
-func (c *HerbalTraceContract) ValidateHarvestLimit(ctx contractapi.TransactionContextInterface, species string, zone string, season string, quantity float64) (bool, error) {
+// checkHarvestLimit checks if adding a quantity would exceed the harvest limit. A quantity in a unit
+// that cannot be converted to the limit's unit is refused with the reason.
+func (c *HerbalTraceContract) checkHarvestLimit(ctx contractapi.TransactionContextInterface, species string, zone string, season string, quantity float64, unit string) (bool, string, error) {
 	if species == "" || zone == "" || season == "" {
-		return false, fmt.Errorf("species, zone, and season are required")
+		return false, "", fmt.Errorf("species, zone, and season are required")
 	}
 	if quantity <= 0 {
-		return false, fmt.Errorf("quantity must be greater than zero")
+		return false, "", fmt.Errorf("quantity must be greater than zero")
 	}
 
 	// Find the harvest limit
-	limitID := fmt.Sprintf("limit_%s_%s_%s",
-		strings.ReplaceAll(species, " ", "_"),
-		strings.ReplaceAll(zone, " ", "_"),
-		strings.ReplaceAll(season, " ", "_"))
+	limitID := harvestLimitKey(species, zone, season)
 
 	limitBytes, err := ctx.GetStub().GetState(limitID)
 	if err != nil {
-		return false, fmt.Errorf("failed to read harvest limit: %v", err)
+		return false, "", fmt.Errorf("failed to read harvest limit: %v", err)
 	}
 	if limitBytes == nil {
 		// No limit set - allow harvest
-		return true, nil
+		return true, "", nil
 	}
 
 	var limit HarvestLimit
 	err = json.Unmarshal(limitBytes, &limit)
 	if err != nil {
-		return false, fmt.Errorf("failed to unmarshal harvest limit: %v", err)
+		return false, "", fmt.Errorf("failed to unmarshal harvest limit: %v", err)
+	}
+	quantity, err = convertQuantity(quantity, unit, limit.Unit)
+	if err != nil {
+		return false, fmt.Sprintf("harvest limit %s: %v", limit.ID, err), nil
 	}
 
 	// Check if adding this quantity would exceed the limit
 	newTotal := limit.CurrentQuantity + quantity
 	if newTotal > limit.MaxQuantity {
-		return false, nil
+		return false, "", nil
 	}
 
-	return true, nil
+	return true, "", nil
 }
 
 // GetHarvestStatistics retrieves the current harvest statistics for a species/zone/season
@@ -411,10 +833,7 @@ func (c *HerbalTraceContract) GetHarvestStatistics(ctx contractapi.TransactionCo
 		return nil, fmt.Errorf("species, zone, and season are required")
 	}
 
-	limitID := fmt.Sprintf("limit_%s_%s_%s",
-		strings.ReplaceAll(species, " ", "_"),
-		strings.ReplaceAll(zone, " ", "_"),
-		strings.ReplaceAll(season, " ", "_"))
+	limitID := harvestLimitKey(species, zone, season)
 
 	limitBytes, err := ctx.GetStub().GetState(limitID)
 	if err != nil {
@@ -433,11 +852,15 @@ func (c *HerbalTraceContract) GetHarvestStatistics(ctx contractapi.TransactionCo
 	return &limit, nil
 }
 
-// ResetSeasonalLimits resets the current quantities for all limits of a given season
+// ResetSeasonalLimits resets the current quantities for all limits of a given season (governed: applied through ExecuteProposal)
 func (c *HerbalTraceContract) ResetSeasonalLimits(ctx contractapi.TransactionContextInterface, season string) error {
 	if season == "" {
 		return fmt.Errorf("season is required")
 	}
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
 
 	queryString := fmt.Sprintf(`{
 		"selector": {
@@ -468,7 +891,7 @@ func (c *HerbalTraceContract) ResetSeasonalLimits(ctx contractapi.TransactionCon
 		// Reset current quantity and status
 		limit.CurrentQuantity = 0
 		limit.Status = "normal"
-		limit.UpdatedAt = time.Now().Format(time.RFC3339)
+		limit.UpdatedAt = txTime.Format(time.RFC3339)
 
 		// Save updated limit
 		limitBytes, err := json.Marshal(limit)
@@ -489,7 +912,7 @@ func (c *HerbalTraceContract) ResetSeasonalLimits(ctx contractapi.TransactionCon
 		"eventType":  "SeasonalLimitsReset",
 		"season":     season,
 		"resetCount": resetCount,
-		"timestamp":  time.Now().Format(time.RFC3339),
+		"timestamp":  txTime.Format(time.RFC3339),
 	}
 	eventBytes, _ := json.Marshal(eventPayload)
 	ctx.GetStub().SetEvent("SeasonalLimitsReset", eventBytes)
@@ -532,25 +955,26 @@ func (c *HerbalTraceContract) GetHarvestLimitAlerts(ctx contractapi.TransactionC
 	return alerts, nil
 }
 
-// getCurrentSeason is a helper function to determine the current season based on date
-func getCurrentSeason() string {
-	now := time.Now()
-	year := strconv.Itoa(now.Year())
-	month := int(now.Month())
-
-	// Define seasons based on Indian climate
-	// Spring: March-May (3-5)
-	// Monsoon: June-September (6-9)
-	// Post-Monsoon: October-November (10-11)
-	// Winter: December-February (12, 1, 2)
-
-	if month >= 3 && month <= 5 {
-		return year + "-Spring"
-	} else if month >= 6 && month <= 9 {
-		return year + "-Monsoon"
-	} else if month >= 10 && month <= 11 {
-		return year + "-Post-Monsoon"
-	} else {
-		return year + "-Winter"
+// maxCaptureClockSkew tolerates device clocks running slightly ahead of the ordering service
+const maxCaptureClockSkew = 5 * time.Minute
+
+// getTxTime returns the transaction timestamp set by the submitting client
+func getTxTime(ctx contractapi.TransactionContextInterface) (time.Time, error) {
+	txTimestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read transaction timestamp: %v", err)
+	}
+	return time.Unix(txTimestamp.Seconds, int64(txTimestamp.Nanos)).UTC(), nil
+}
+
+// parseLedgerDate parses a date stored on the ledger as RFC3339 or YYYY-MM-DD
+func parseLedgerDate(value string) (time.Time, error) {
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsed, nil
+	}
+	parsed, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("date %q must be RFC3339 or YYYY-MM-DD", value)
 	}
+	return parsed, nil
 }
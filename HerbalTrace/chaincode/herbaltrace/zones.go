@@ -0,0 +1,338 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// ApprovedZone is one version of an NMPB-approved harvesting zone for a set of species.
+// A version applies to harvests dated from ActiveFrom (inclusive) until ActiveUntil (exclusive).
+type ApprovedZone struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"` // "ApprovedZone"
+	ZoneID      string          `json:"zoneId"`
+	Version     int             `json:"version"`
+	Name        string          `json:"name"`
+	Region      string          `json:"region,omitempty"`
+	Species     []string        `json:"species"`
+	Geometry    GeoJSONGeometry `json:"geometry"`
+	ActiveFrom  string          `json:"activeFrom"`            // YYYY-MM-DD or RFC3339
+	ActiveUntil string          `json:"activeUntil,omitempty"` // Empty = open-ended
+	Status      string          `json:"status"`                // "active", "superseded"
+	CreatedBy   string          `json:"createdBy"`
+	CreatedAt   string          `json:"createdAt"`
+	UpdatedAt   string          `json:"updatedAt"`
+}
+
+// approvedZoneKey returns the ledger key for a version of an approved zone
+func approvedZoneKey(zoneID string, version int) string {
+	return fmt.Sprintf("approvedzone_%s_v%d", zoneID, version)
+}
+
+// CreateApprovedZone registers the first version of an approved zone
+// (governed: applied through ExecuteProposal)
+func (c *HerbalTraceContract) CreateApprovedZone(ctx contractapi.TransactionContextInterface, zoneJSON string) error {
+	var zone ApprovedZone
+	err := json.Unmarshal([]byte(zoneJSON), &zone)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal approved zone JSON: %v", err)
+	}
+
+	versions, err := c.GetApprovedZoneVersions(ctx, zone.ZoneID)
+	if err != nil {
+		return err
+	}
+	if len(versions) > 0 {
+		return fmt.Errorf("approved zone %s already exists; submit an UpdateApprovedZone proposal to change it", zone.ZoneID)
+	}
+
+	zone.Version = 1
+	return c.putApprovedZone(ctx, &zone, "ApprovedZoneCreated")
+}
+
+// UpdateApprovedZone registers a new version of an approved zone and closes the previous version
+// at the new version's ActiveFrom date (governed: applied through ExecuteProposal)
+func (c *HerbalTraceContract) UpdateApprovedZone(ctx contractapi.TransactionContextInterface, zoneID string, zoneJSON string) error {
+	var zone ApprovedZone
+	err := json.Unmarshal([]byte(zoneJSON), &zone)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal approved zone JSON: %v", err)
+	}
+
+	previous, err := c.GetApprovedZone(ctx, zoneID)
+	if err != nil {
+		return err
+	}
+
+	newFrom, err := parseLedgerDate(zone.ActiveFrom)
+	if err != nil {
+		return fmt.Errorf("invalid active from date: %v", err)
+	}
+	previousFrom, err := parseLedgerDate(previous.ActiveFrom)
+	if err == nil && !newFrom.After(previousFrom) {
+		return fmt.Errorf("version %d of zone %s must become active after %s", previous.Version+1, zoneID, previous.ActiveFrom)
+	}
+
+	zone.ZoneID = zoneID
+	zone.Version = previous.Version + 1
+	if err := c.putApprovedZone(ctx, &zone, "ApprovedZoneUpdated"); err != nil {
+		return err
+	}
+
+	previousUntil, err := parseLedgerDate(previous.ActiveUntil)
+	if previous.ActiveUntil == "" || err != nil || previousUntil.After(newFrom) {
+		previous.ActiveUntil = zone.ActiveFrom
+	}
+	previous.Status = "superseded"
+	previous.UpdatedAt = zone.CreatedAt
+
+	previousBytes, err := json.Marshal(previous)
+	if err != nil {
+		return fmt.Errorf("failed to marshal approved zone: %v", err)
+	}
+	err = ctx.GetStub().PutState(previous.ID, previousBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update approved zone: %v", err)
+	}
+
+	return nil
+}
+
+// GetApprovedZone retrieves the latest version of an approved zone
+func (c *HerbalTraceContract) GetApprovedZone(ctx contractapi.TransactionContextInterface, zoneID string) (*ApprovedZone, error) {
+	versions, err := c.GetApprovedZoneVersions(ctx, zoneID)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("approved zone %s does not exist", zoneID)
+	}
+
+	latest := versions[0]
+	for _, zone := range versions[1:] {
+		if zone.Version > latest.Version {
+			latest = zone
+		}
+	}
+
+	return latest, nil
+}
+
+// GetApprovedZoneVersion retrieves a specific version of an approved zone
+func (c *HerbalTraceContract) GetApprovedZoneVersion(ctx contractapi.TransactionContextInterface, zoneID string, version int) (*ApprovedZone, error) {
+	zoneBytes, err := ctx.GetStub().GetState(approvedZoneKey(zoneID, version))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read approved zone: %v", err)
+	}
+	if zoneBytes == nil {
+		return nil, fmt.Errorf("approved zone %s version %d does not exist", zoneID, version)
+	}
+
+	var zone ApprovedZone
+	err = json.Unmarshal(zoneBytes, &zone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal approved zone: %v", err)
+	}
+
+	return &zone, nil
+}
+
+// GetApprovedZoneVersions retrieves every version of an approved zone
+func (c *HerbalTraceContract) GetApprovedZoneVersions(ctx contractapi.TransactionContextInterface, zoneID string) ([]*ApprovedZone, error) {
+	if zoneID == "" {
+		return nil, fmt.Errorf("zone ID is required")
+	}
+
+	queryString := fmt.Sprintf(`{"selector":{"type":"ApprovedZone","zoneId":"%s"}}`, zoneID)
+	return c.queryApprovedZones(ctx, queryString)
+}
+
+// QueryApprovedZonesBySpecies retrieves the active approved zones of a species
+func (c *HerbalTraceContract) QueryApprovedZonesBySpecies(ctx contractapi.TransactionContextInterface, species string) ([]*ApprovedZone, error) {
+	queryString := fmt.Sprintf(`{"selector":{"type":"ApprovedZone","status":"active","species":{"$elemMatch":{"$eq":"%s"}}}}`, species)
+	return c.queryApprovedZones(ctx, queryString)
+}
+
+// validateGeoFencing checks the collection location against the approved zones of the species that
+// were in force on the harvest date. A location within the event's GPS accuracy radius of a zone
+// boundary is accepted. It returns every matching zone version, those containing the exact location
+// first; the result is empty when the location is outside every approved zone.
+func (c *HerbalTraceContract) validateGeoFencing(ctx contractapi.TransactionContextInterface, event *CollectionEvent) ([]*ApprovedZone, error) {
+	if event.Latitude < -90 || event.Latitude > 90 || event.Longitude < -180 || event.Longitude > 180 {
+		return nil, nil
+	}
+
+	harvestDate, err := parseLedgerDate(event.HarvestDate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid harvest date: %v", err)
+	}
+
+	// Every version is considered so that back-dated harvests use the zone boundaries of their date
+	queryString := fmt.Sprintf(`{"selector":{"type":"ApprovedZone","species":{"$elemMatch":{"$eq":"%s"}}}}`, event.Species)
+	zones, err := c.queryApprovedZones(ctx, queryString)
+	if err != nil {
+		return nil, err
+	}
+
+	var containing, nearby []*ApprovedZone
+	for _, zone := range zones {
+		if !zone.activeOn(harvestDate) {
+			continue
+		}
+		polygons, err := zone.Geometry.polygons()
+		if err != nil {
+			return nil, fmt.Errorf("approved zone %s version %d has invalid geometry: %v", zone.ZoneID, zone.Version, err)
+		}
+
+		inside, near := false, false
+		for _, polygon := range polygons {
+			if polygon.containsPoint(event.Latitude, event.Longitude) {
+				inside = true
+				break
+			}
+			if event.Accuracy > 0 && polygon.distanceToBoundary(event.Latitude, event.Longitude) <= event.Accuracy {
+				near = true
+			}
+		}
+		if inside {
+			containing = append(containing, zone)
+		} else if near {
+			nearby = append(nearby, zone)
+		}
+	}
+
+	return append(containing, nearby...), nil
+}
+
+// resolveZone picks the zone a collection event belongs to from the zones matching its location.
+// A zone claimed by the client must be one of them (by name or zone ID); otherwise the closest
+// match is used. It returns nil when the claimed zone disagrees with the geometry.
+func resolveZone(zones []*ApprovedZone, claimed string) *ApprovedZone {
+	if claimed == "" {
+		return zones[0]
+	}
+	for _, zone := range zones {
+		if zone.Name == claimed || zone.ZoneID == claimed {
+			return zone
+		}
+	}
+	return nil
+}
+
+// activeOn reports whether the zone version applies to a harvest on the given date
+func (z *ApprovedZone) activeOn(date time.Time) bool {
+	activeFrom, err := parseLedgerDate(z.ActiveFrom)
+	if err != nil || date.Before(activeFrom) {
+		return false
+	}
+	if z.ActiveUntil == "" {
+		return true
+	}
+	activeUntil, err := parseLedgerDate(z.ActiveUntil)
+	return err == nil && date.Before(activeUntil)
+}
+
+// putApprovedZone validates and saves a new approved zone version
+func (c *HerbalTraceContract) putApprovedZone(ctx contractapi.TransactionContextInterface, zone *ApprovedZone, eventName string) error {
+	if zone.ZoneID == "" {
+		return fmt.Errorf("zone ID is required")
+	}
+	if zone.Name == "" {
+		return fmt.Errorf("zone name is required")
+	}
+	if len(zone.Species) == 0 {
+		return fmt.Errorf("at least one species is required")
+	}
+	for i, name := range zone.Species {
+		speciesID, err := c.normalizeSpecies(ctx, name)
+		if err != nil {
+			return err
+		}
+		zone.Species[i] = speciesID
+	}
+	if _, err := zone.Geometry.polygons(); err != nil {
+		return err
+	}
+	activeFrom, err := parseLedgerDate(zone.ActiveFrom)
+	if err != nil {
+		return fmt.Errorf("invalid active from date: %v", err)
+	}
+	if zone.ActiveUntil != "" {
+		activeUntil, err := parseLedgerDate(zone.ActiveUntil)
+		if err != nil {
+			return fmt.Errorf("invalid active until date: %v", err)
+		}
+		if !activeUntil.After(activeFrom) {
+			return fmt.Errorf("active until date must be after active from date")
+		}
+	}
+
+	identity, err := getClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	zone.ID = approvedZoneKey(zone.ZoneID, zone.Version)
+	zone.Type = "ApprovedZone"
+	zone.Status = "active"
+	zone.CreatedBy = identity.EnrollmentID
+	zone.CreatedAt = txTime.Format(time.RFC3339)
+	zone.UpdatedAt = zone.CreatedAt
+
+	zoneBytes, err := json.Marshal(zone)
+	if err != nil {
+		return fmt.Errorf("failed to marshal approved zone: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(zone.ID, zoneBytes)
+	if err != nil {
+		return fmt.Errorf("failed to save approved zone to ledger: %v", err)
+	}
+
+	// Emit event
+	eventPayload := map[string]interface{}{
+		"eventType":  eventName,
+		"zoneId":     zone.ZoneID,
+		"version":    zone.Version,
+		"species":    zone.Species,
+		"activeFrom": zone.ActiveFrom,
+		"timestamp":  zone.CreatedAt,
+	}
+	eventBytes, _ := json.Marshal(eventPayload)
+	ctx.GetStub().SetEvent(eventName, eventBytes)
+
+	return nil
+}
+
+// queryApprovedZones runs a rich query for approved zones
+func (c *HerbalTraceContract) queryApprovedZones(ctx contractapi.TransactionContextInterface, queryString string) ([]*ApprovedZone, error) {
+	resultsIterator, err := ctx.GetStub().GetQueryResult(queryString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query approved zones: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	var zones []*ApprovedZone
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var zone ApprovedZone
+		err = json.Unmarshal(queryResponse.Value, &zone)
+		if err != nil {
+			return nil, err
+		}
+		zones = append(zones, &zone)
+	}
+
+	return zones, nil
+}
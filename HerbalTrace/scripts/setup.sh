@@ -427,6 +427,9 @@ peer lifecycle chaincode package herbaltrace.tar.gz \
   --lang golang \
   --label herbaltrace_1.0
 
+# Private data collections (farmer PII and harvest coordinates, farmer-processor commercial terms)
+CC_COLLECTIONS_CONFIG=${PROJECT_ROOT}/chaincode/herbaltrace/collections_config.json
+
 println "Installing chaincode on all peers..."
 # Install on all organizations (simplified - install on peer0 of each org)
 
@@ -475,7 +478,8 @@ export CORE_PEER_ADDRESS=localhost:7051
 
 peer lifecycle chaincode approveformyorg -o localhost:7050 --ordererTLSHostnameOverride orderer.herbaltrace.com \
   --tls --cafile $ORDERER_CA --channelID $CHANNEL_NAME --name herbaltrace --version 1.0 \
-  --package-id $PACKAGE_ID --sequence 1
+  --package-id $PACKAGE_ID --sequence 1 \
+  --collections-config $CC_COLLECTIONS_CONFIG
 
 # Approve for TestingLabs
 export CORE_PEER_LOCALMSPID="TestingLabsMSP"
@@ -485,7 +489,8 @@ export CORE_PEER_ADDRESS=localhost:9051
 
 peer lifecycle chaincode approveformyorg -o localhost:7050 --ordererTLSHostnameOverride orderer.herbaltrace.com \
   --tls --cafile $ORDERER_CA --channelID $CHANNEL_NAME --name herbaltrace --version 1.0 \
-  --package-id $PACKAGE_ID --sequence 1
+  --package-id $PACKAGE_ID --sequence 1 \
+  --collections-config $CC_COLLECTIONS_CONFIG
 
 # Approve for Processors
 export CORE_PEER_LOCALMSPID="ProcessorsMSP"
@@ -495,7 +500,8 @@ export CORE_PEER_ADDRESS=localhost:11051
 
 peer lifecycle chaincode approveformyorg -o localhost:7050 --ordererTLSHostnameOverride orderer.herbaltrace.com \
   --tls --cafile $ORDERER_CA --channelID $CHANNEL_NAME --name herbaltrace --version 1.0 \
-  --package-id $PACKAGE_ID --sequence 1
+  --package-id $PACKAGE_ID --sequence 1 \
+  --collections-config $CC_COLLECTIONS_CONFIG
 
 # Approve for Manufacturers
 export CORE_PEER_LOCALMSPID="ManufacturersMSP"
@@ -505,11 +511,13 @@ export CORE_PEER_ADDRESS=localhost:13051
 
 peer lifecycle chaincode approveformyorg -o localhost:7050 --ordererTLSHostnameOverride orderer.herbaltrace.com \
   --tls --cafile $ORDERER_CA --channelID $CHANNEL_NAME --name herbaltrace --version 1.0 \
-  --package-id $PACKAGE_ID --sequence 1
+  --package-id $PACKAGE_ID --sequence 1 \
+  --collections-config $CC_COLLECTIONS_CONFIG
 
 println "Committing chaincode definition..."
 peer lifecycle chaincode commit -o localhost:7050 --ordererTLSHostnameOverride orderer.herbaltrace.com \
   --tls --cafile $ORDERER_CA --channelID $CHANNEL_NAME --name herbaltrace --version 1.0 --sequence 1 \
+  --collections-config $CC_COLLECTIONS_CONFIG \
   --peerAddresses localhost:7051 --tlsRootCertFiles ${PWD}/organizations/peerOrganizations/farmers.herbaltrace.com/peers/peer0.farmers.herbaltrace.com/tls/ca.crt \
   --peerAddresses localhost:9051 --tlsRootCertFiles ${PWD}/organizations/peerOrganizations/labs.herbaltrace.com/peers/peer0.labs.herbaltrace.com/tls/ca.crt \
   --peerAddresses localhost:11051 --tlsRootCertFiles ${PWD}/organizations/peerOrganizations/processors.herbaltrace.com/peers/peer0.processors.herbaltrace.com/tls/ca.crt \